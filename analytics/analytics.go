@@ -0,0 +1,192 @@
+package analytics
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// Event is the document of a request
+type Event struct {
+	TransID string `json:"trans_id"`
+	// Endpoint is the route pattern, e.g. /sample/{sampleId}
+	Endpoint string `json:"endpoint"`
+	Method   string `json:"method"`
+	Status   int    `json:"status"`
+	// ElapsedTime is in milliseconds
+	ElapsedTime float64 `json:"elapsed_time"`
+	ContainerID string  `json:"container_id"`
+	// UserID is empty until the API has authentication
+	UserID string    `json:"user_id,omitempty"`
+	Time   time.Time `json:"time"`
+}
+
+// NewTransID returns a random ID of a request for Event.TransID
+func NewTransID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Sink is where the events are shipped in batches
+type Sink interface {
+	Write(ctx context.Context, events []*Event) error
+}
+
+// DropPolicy tells which event is dropped when the queue is full
+type DropPolicy int
+
+const (
+	// DropNewest drops the event being emitted
+	DropNewest DropPolicy = iota
+	// DropOldest drops the oldest event in the queue to make room for the new one
+	DropOldest
+)
+
+// the defaults of Options
+const (
+	DefaultQueueSize     = 10000
+	DefaultBatchSize     = 500
+	DefaultFlushInterval = 5 * time.Second
+	DefaultFlushTimeout  = 10 * time.Second
+)
+
+// Options configures a Pipeline, the zero values are the defaults
+type Options struct {
+	// QueueSize is the maximum number of the events waiting for a batch
+	QueueSize int
+	// BatchSize is the maximum number of the events in a batch, a full batch is written at once
+	BatchSize int
+	// FlushInterval is how long an event waits at most for the batch to be full
+	FlushInterval time.Duration
+	// FlushTimeout is the deadline of writing a batch
+	FlushTimeout time.Duration
+	DropPolicy   DropPolicy
+	// ContainerID is set to every event, the host name is used when empty
+	ContainerID string
+	// OnError is called when a batch can't be written, the batch is dropped then
+	OnError func(err error, events int)
+}
+
+// Pipeline ships the events to the sink in the background, see Run.
+// Emit never blocks the request, the events are dropped when the sink can't keep up.
+type Pipeline struct {
+	// dropped is updated atomically, it comes first for the alignment on 32 bit platforms
+	dropped uint64
+
+	sink  Sink
+	opts  Options
+	queue chan *Event
+}
+
+// NewPipeline returns a Pipeline which writes to sink, opts may be nil
+func NewPipeline(sink Sink, opts *Options) *Pipeline {
+	o := Options{}
+	if opts != nil {
+		o = *opts
+	}
+	if o.QueueSize <= 0 {
+		o.QueueSize = DefaultQueueSize
+	}
+	if o.BatchSize <= 0 {
+		o.BatchSize = DefaultBatchSize
+	}
+	if o.FlushInterval <= 0 {
+		o.FlushInterval = DefaultFlushInterval
+	}
+	if o.FlushTimeout <= 0 {
+		o.FlushTimeout = DefaultFlushTimeout
+	}
+	if o.ContainerID == "" {
+		o.ContainerID, _ = os.Hostname()
+	}
+
+	return &Pipeline{
+		sink:  sink,
+		opts:  o,
+		queue: make(chan *Event, o.QueueSize),
+	}
+}
+
+// Emit queues the event, it reports false when an event is dropped because the queue is full
+func (p *Pipeline) Emit(e *Event) bool {
+	if e.ContainerID == "" {
+		e.ContainerID = p.opts.ContainerID
+	}
+
+	select {
+	case p.queue <- e:
+		return true
+	default:
+	}
+
+	if p.opts.DropPolicy == DropOldest {
+		// the queue may be drained or filled by others in the meantime, then the new one is dropped
+		select {
+		case <-p.queue:
+			atomic.AddUint64(&p.dropped, 1)
+		default:
+		}
+		select {
+		case p.queue <- e:
+			return false
+		default:
+		}
+	}
+	atomic.AddUint64(&p.dropped, 1)
+	return false
+}
+
+// Dropped is the number of the events dropped because the queue was full
+func (p *Pipeline) Dropped() uint64 {
+	return atomic.LoadUint64(&p.dropped)
+}
+
+// Run writes the events in batches until ctx is done, then it writes the events left in the queue and returns.
+// The events emitted after that are not written.
+func (p *Pipeline) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.opts.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*Event, 0, p.opts.BatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		// the batch is written even after ctx is done, that's the shutdown
+		writeCtx, cancel := context.WithTimeout(context.Background(), p.opts.FlushTimeout)
+		defer cancel()
+		if err := p.sink.Write(writeCtx, batch); err != nil && p.opts.OnError != nil {
+			p.opts.OnError(err, len(batch))
+		}
+		batch = make([]*Event, 0, p.opts.BatchSize)
+	}
+
+	for {
+		select {
+		case e := <-p.queue:
+			batch = append(batch, e)
+			if len(batch) >= p.opts.BatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-ctx.Done():
+			for {
+				select {
+				case e := <-p.queue:
+					batch = append(batch, e)
+					if len(batch) >= p.opts.BatchSize {
+						flush()
+					}
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,291 @@
+package analytics
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memorySink keeps the batches written
+type memorySink struct {
+	mu      sync.Mutex
+	batches [][]*Event
+	err     error
+}
+
+func (s *memorySink) Write(ctx context.Context, events []*Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.batches = append(s.batches, append([]*Event(nil), events...))
+	return s.err
+}
+
+func (s *memorySink) sizes() []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sizes := []int{}
+	for _, b := range s.batches {
+		sizes = append(sizes, len(b))
+	}
+	return sizes
+}
+
+func TestPipelineBatchSize(t *testing.T) {
+	sink := &memorySink{}
+	p := NewPipeline(sink, &Options{BatchSize: 2, FlushInterval: time.Hour})
+	for i := 0; i < 5; i++ {
+		p.Emit(&Event{Status: 200})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		p.Run(ctx)
+		close(done)
+	}()
+
+	deadline := time.Now().Add(time.Second)
+	for len(sink.sizes()) < 2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got := sink.sizes(); len(got) != 2 || got[0] != 2 || got[1] != 2 {
+		t.Errorf("test failed, got: %v, want: [2 2]", got)
+	}
+
+	// the last one is flushed at the shutdown
+	cancel()
+	<-done
+	if got := sink.sizes(); len(got) != 3 || got[2] != 1 {
+		t.Errorf("test failed, got: %v, want: [2 2 1]", got)
+	}
+}
+
+func TestPipelineFlushInterval(t *testing.T) {
+	sink := &memorySink{}
+	p := NewPipeline(sink, &Options{BatchSize: 100, FlushInterval: 10 * time.Millisecond, ContainerID: "c1"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go p.Run(ctx)
+	p.Emit(&Event{Status: 200})
+
+	deadline := time.Now().Add(time.Second)
+	for len(sink.sizes()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	got := sink.sizes()
+	if len(got) != 1 || got[0] != 1 {
+		t.Fatalf("test failed, got: %v, want: [1]", got)
+	}
+	if c := sink.batches[0][0].ContainerID; c != "c1" {
+		t.Errorf("test failed, got: %v, want: %v", c, "c1")
+	}
+}
+
+func TestPipelineDropPolicy(t *testing.T) {
+	type testCase struct {
+		Scenario string
+		Policy   DropPolicy
+		Expected []int
+	}
+	testCases := []testCase{
+		{"drop newest", DropNewest, []int{1, 2}},
+		{"drop oldest", DropOldest, []int{3, 4}},
+	}
+
+	for _, tc := range testCases {
+		sink := &memorySink{}
+		p := NewPipeline(sink, &Options{QueueSize: 2, DropPolicy: tc.Policy})
+		accepted := 0
+		for i := 1; i <= 4; i++ {
+			if p.Emit(&Event{Status: i}) {
+				accepted++
+			}
+		}
+		if accepted != 2 {
+			t.Errorf("%s: test failed, got: %v accepted, want: 2", tc.Scenario, accepted)
+		}
+		if d := p.Dropped(); d != 2 {
+			t.Errorf("%s: test failed, got: %v dropped, want: 2", tc.Scenario, d)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		p.Run(ctx)
+		got := []int{}
+		for _, b := range sink.batches {
+			for _, e := range b {
+				got = append(got, e.Status)
+			}
+		}
+		if len(got) != len(tc.Expected) || got[0] != tc.Expected[0] || got[1] != tc.Expected[1] {
+			t.Errorf("%s: test failed, got: %v, want: %v", tc.Scenario, got, tc.Expected)
+		}
+	}
+}
+
+func TestPipelineOnError(t *testing.T) {
+	sink := &memorySink{err: errors.New("unavailable")}
+	var lost int
+	p := NewPipeline(sink, &Options{OnError: func(err error, events int) { lost += events }})
+	p.Emit(&Event{})
+	p.Emit(&Event{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	p.Run(ctx)
+	if lost != 2 {
+		t.Errorf("test failed, got: %v, want: %v", lost, 2)
+	}
+}
+
+func TestWriterSink(t *testing.T) {
+	var buf bytes.Buffer
+	s := NewWriterSink(&buf)
+	events := []*Event{{TransID: "a", Endpoint: "/sample/{sampleId}"}, {TransID: "b", UserID: "u1"}}
+	if err := s.Write(context.Background(), events); err != nil {
+		t.Fatalf("expected non error, but some error occurred, %s", err.Error())
+	}
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("test failed, got: %v lines, want: 2", len(lines))
+	}
+	e := &Event{}
+	if err := json.Unmarshal([]byte(lines[1]), e); err != nil || e.TransID != "b" || e.UserID != "u1" {
+		t.Errorf("test failed, got: %v, want: %v", lines[1], events[1])
+	}
+	if strings.Contains(lines[0], "user_id") {
+		t.Errorf("test failed, got: %v, want: no user_id", lines[0])
+	}
+}
+
+func TestFileSinkClose(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.ndjson")
+	s, err := NewFileSink(path)
+	if err != nil {
+		t.Fatalf("expected non error, but some error occurred, %s", err.Error())
+	}
+	if err := s.Write(context.Background(), []*Event{{TransID: "a"}}); err != nil {
+		t.Fatalf("expected non error, but some error occurred, %s", err.Error())
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("expected non error, but some error occurred, %s", err.Error())
+	}
+	if err := s.Write(context.Background(), []*Event{{TransID: "b"}}); err == nil {
+		t.Errorf("test failed, the file is still open after Close")
+	}
+	b, _ := os.ReadFile(path)
+	if got := strings.Count(string(b), "\n"); got != 1 {
+		t.Errorf("test failed, got: %v lines, want: 1", got)
+	}
+
+	// the writers given to NewWriterSink are not closed
+	w := &closeRecorder{}
+	if err := NewWriterSink(w).Close(); err != nil || w.closed {
+		t.Errorf("test failed, got: %v, %v, want: the writer is left open", err, w.closed)
+	}
+}
+
+// closeRecorder is a writer which records whether it's closed
+type closeRecorder struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (c *closeRecorder) Close() error {
+	c.closed = true
+	return nil
+}
+
+// bulkStub is an Elasticsearch _bulk endpoint which fails the documents of the status 500
+func bulkStub(t *testing.T, received *[]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ct := r.Header.Get("Content-Type"); ct != "application/x-ndjson" {
+			t.Errorf("test failed, got: %v, want: %v", ct, "application/x-ndjson")
+		}
+		body, _ := io.ReadAll(r.Body)
+		items, hasErrors := []interface{}{}, false
+		scanner := bufio.NewScanner(bytes.NewReader(body))
+		for scanner.Scan() {
+			action := map[string]map[string]string{}
+			json.Unmarshal(scanner.Bytes(), &action)
+			if !scanner.Scan() {
+				http.Error(w, "no document", http.StatusBadRequest)
+				return
+			}
+			*received = append(*received, action["index"]["_index"]+" "+scanner.Text())
+
+			e := &Event{}
+			json.Unmarshal(scanner.Bytes(), e)
+			if e.Status == 500 {
+				hasErrors = true
+				items = append(items, map[string]interface{}{"index": map[string]interface{}{
+					"status": 400, "error": map[string]string{"type": "mapper_parsing_exception", "reason": "failed"},
+				}})
+				continue
+			}
+			items = append(items, map[string]interface{}{"index": map[string]interface{}{"status": 201}})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"took": 1, "errors": hasErrors, "items": items})
+	}))
+}
+
+func TestBulkSink(t *testing.T) {
+	received := []string{}
+	srv := bulkStub(t, &received)
+	defer srv.Close()
+
+	s := NewBulkSink(srv.URL+"/_bulk", "requests", srv.Client())
+	err := s.Write(context.Background(), []*Event{{TransID: "a", Status: 200}, {TransID: "b", Status: 404}})
+	if err != nil {
+		t.Fatalf("expected non error, but some error occurred, %s", err.Error())
+	}
+	if len(received) != 2 || !strings.HasPrefix(received[0], `requests {"trans_id":"a"`) {
+		t.Errorf("test failed, got: %v", received)
+	}
+
+	err = s.Write(context.Background(), []*Event{{TransID: "c", Status: 200}, {TransID: "d", Status: 500}})
+	if err == nil || !strings.Contains(err.Error(), "1 of 2") {
+		t.Errorf("test failed, got: %v, want: an error of 1 of 2 events", err)
+	}
+
+	srv.Close()
+	if err := s.Write(context.Background(), []*Event{{TransID: "e"}}); err == nil {
+		t.Errorf("expected error, but no error occurred")
+	}
+}
+
+func TestNewSink(t *testing.T) {
+	type testCase struct {
+		Scenario string
+		Spec     string
+		Index    string
+		Valid    bool
+	}
+	testCases := []testCase{
+		{"stdout", "stdout", "", true},
+		{"file", "file://" + t.TempDir() + "/events.ndjson", "", true},
+		{"bulk", "http://localhost:9200/_bulk", "requests", true},
+		{"bulk without index", "http://localhost:9200/_bulk", "", false},
+		{"unknown", "kafka://localhost", "", false},
+	}
+
+	for _, tc := range testCases {
+		_, err := NewSink(tc.Spec, tc.Index)
+		if got := err == nil; got != tc.Valid {
+			t.Errorf("%s: test failed, got: %v, want: %v", tc.Scenario, err, tc.Valid)
+		}
+	}
+}
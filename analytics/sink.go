@@ -0,0 +1,174 @@
+package analytics
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+)
+
+// WriterSink writes the events as NDJSON, one event per line
+type WriterSink struct {
+	mu sync.Mutex
+	w  io.Writer
+	// file is the file which NewFileSink opened, it's nil for the writers given to NewWriterSink
+	file *os.File
+}
+
+// NewWriterSink returns a WriterSink which writes to w, e.g. os.Stdout
+func NewWriterSink(w io.Writer) *WriterSink {
+	return &WriterSink{w: w}
+}
+
+// NewFileSink returns a WriterSink which appends to the file of path, the file is created if it doesn't exist
+func NewFileSink(path string) (*WriterSink, error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &WriterSink{w: f, file: f}, nil
+}
+
+// Write writes a batch with a single write, so that the lines of concurrent writers are not mixed
+func (s *WriterSink) Write(ctx context.Context, events []*Event) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, e := range events {
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := s.w.Write(buf.Bytes())
+	return err
+}
+
+// Close closes the file of a sink of NewFileSink, the writers given to NewWriterSink such as os.Stdout are left open.
+// It has to be called after the last Write.
+func (s *WriterSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	return s.file.Close()
+}
+
+// BulkSink posts the events to an endpoint compatible with the Elasticsearch _bulk API,
+// every event is indexed as a new document of the index
+type BulkSink struct {
+	url    string
+	index  string
+	client *http.Client
+}
+
+// NewBulkSink returns a BulkSink which posts to the URL of the _bulk endpoint, e.g. http://localhost:9200/_bulk.
+// http.DefaultClient is used when client is nil.
+func NewBulkSink(url string, index string, client *http.Client) *BulkSink {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &BulkSink{url: url, index: index, client: client}
+}
+
+// bulkResponse is the part of the response of _bulk which tells whether any item failed
+type bulkResponse struct {
+	Errors bool `json:"errors"`
+	Items  []map[string]struct {
+		Status int `json:"status"`
+		Error  *struct {
+			Type   string `json:"type"`
+			Reason string `json:"reason"`
+		} `json:"error"`
+	} `json:"items"`
+}
+
+func (s *BulkSink) Write(ctx context.Context, events []*Event) error {
+	action, err := json.Marshal(map[string]interface{}{"index": map[string]string{"_index": s.index}})
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, e := range events {
+		buf.Write(action)
+		buf.WriteByte('\n')
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, &buf)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	res, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	if res.StatusCode/100 != 2 {
+		return fmt.Errorf("bulk request failed: %s", res.Status)
+	}
+
+	// the status is 200 even when some items failed
+	br := &bulkResponse{}
+	if err := json.Unmarshal(body, br); err != nil {
+		return fmt.Errorf("invalid bulk response: %w", err)
+	}
+	if br.Errors {
+		failed, reason := 0, ""
+		for _, item := range br.Items {
+			for _, result := range item {
+				if result.Error != nil {
+					failed++
+					reason = result.Error.Type + ": " + result.Error.Reason
+				}
+			}
+		}
+		return fmt.Errorf("%d of %d events failed in the bulk request, %s", failed, len(events), reason)
+	}
+
+	return nil
+}
+
+// NewSink returns the sink of spec, which is "stdout", a file path as file:///var/log/events.ndjson,
+// or the URL of a _bulk endpoint which indexes the events into index
+func NewSink(spec string, index string) (Sink, error) {
+	switch {
+	case spec == "stdout":
+		return NewWriterSink(os.Stdout), nil
+	case strings.HasPrefix(spec, "file:"):
+		u, err := url.Parse(spec)
+		if err != nil {
+			return nil, err
+		}
+		path := u.Path
+		if path == "" {
+			// file:relative/path
+			path = u.Opaque
+		}
+		return NewFileSink(path)
+	case strings.HasPrefix(spec, "http://"), strings.HasPrefix(spec, "https://"):
+		if index == "" {
+			return nil, fmt.Errorf("the index of %s is not given", spec)
+		}
+		return NewBulkSink(spec, index, nil), nil
+	}
+
+	return nil, fmt.Errorf("unknown analytics sink: %s", spec)
+}
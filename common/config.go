@@ -6,4 +6,19 @@ const (
 
 	MYSQL_URL = "MYSQL_URL"
 	REDIS_URL = "REDIS_URL"
+
+	// MYSQL_QUERY_TIMEOUT is the default deadline of a query, e.g. "3s". "0" disables it
+	MYSQL_QUERY_TIMEOUT = "MYSQL_QUERY_TIMEOUT"
+	// AUTO_MIGRATE applies pending migrations at startup when it's "true"
+	AUTO_MIGRATE = "AUTO_MIGRATE"
+
+	// ANALYTICS_SINK is where the request events are shipped, "stdout", "file:///path/to/events.ndjson"
+	// or the URL of an Elasticsearch _bulk endpoint. The events are not shipped when it's empty
+	ANALYTICS_SINK = "ANALYTICS_SINK"
+	// ANALYTICS_INDEX is the index of the events in the _bulk endpoint
+	ANALYTICS_INDEX = "ANALYTICS_INDEX"
+
+	// TRACING_EXPORTER is where the spans are exported, "otlp", "stdout" or "none", the default.
+	// OTLP is configured by the standard OTEL_EXPORTER_OTLP_* variables
+	TRACING_EXPORTER = "TRACING_EXPORTER"
 )
@@ -0,0 +1,258 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	mysql "github.com/sunao-uehara/go-restapi-sample/storages/mysql"
+)
+
+const (
+	// contentTypeNDJSON is newline delimited JSON, one operation per line
+	contentTypeNDJSON = "application/x-ndjson"
+	// maxBulkOperations is the maximum number of operations of a bulk request
+	maxBulkOperations = 1000
+	// maxBulkBodyBytes is the maximum size of the body of a bulk request
+	maxBulkBodyBytes = 8 << 20
+)
+
+// SampleBulkOperation is an operation of POST /sample/_bulk.
+// Data of create is same as POST /sample, data of update is a JSON Merge Patch.
+type SampleBulkOperation struct {
+	Op      string          `json:"op"`
+	ID      int64           `json:"id,omitempty"`
+	Version int64           `json:"version,omitempty"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+// SampleBulkResult is the result of an operation, Status is a HTTP status code.
+// Code, Error and Errors tell the problem of a failed operation as code, detail and errors of problem details.
+type SampleBulkResult struct {
+	Op     string        `json:"op" xml:"op"`
+	ID     int64         `json:"id,omitempty" xml:"id,omitempty"`
+	Status int           `json:"status" xml:"status"`
+	Code   ErrorCode     `json:"code,omitempty" xml:"code,omitempty"`
+	Error  string        `json:"error,omitempty" xml:"error,omitempty"`
+	Errors []*FieldError `json:"errors,omitempty" xml:"errors>error,omitempty"`
+}
+
+// setError sets the problem of a failed operation
+func (sbr *SampleBulkResult) setError(e *Error) {
+	sbr.Status, sbr.Code, sbr.Error, sbr.Errors = e.Status, e.Code, e.Detail, e.Fields
+	if sbr.Error == "" {
+		sbr.Error = http.StatusText(e.Status)
+	}
+}
+
+// SampleBulkResponse is the response of POST /sample/_bulk, Items are in the order of the operations
+type SampleBulkResponse struct {
+	Errors bool                `json:"errors" xml:"errors"`
+	Items  []*SampleBulkResult `json:"items" xml:"items>item"`
+}
+
+// SampleBulkHandler creates, updates and deletes samples in a single transaction.
+// The body is a JSON array of operations, or NDJSON with Content-Type application/x-ndjson.
+// By default nothing is committed when any operation fails and 422 is returned,
+// with atomic=false the operations which succeeded are committed and 200 is returned.
+func (h *Handler) SampleBulkHandler(w http.ResponseWriter, r *http.Request) {
+	h.logger(r.Context()).Debug("SampleBulkHandler")
+	ctx := r.Context()
+
+	atomic := true
+	if v := r.URL.Query().Get("atomic"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			h.problemResponse(w, r, invalidParameterError("atomic must be a boolean", err))
+			return
+		}
+		atomic = b
+	}
+
+	reqs, err := decodeBulkOperations(http.MaxBytesReader(w, r.Body, maxBulkBodyBytes), requestMediaType(r) == contentTypeNDJSON)
+	if err != nil {
+		h.problemResponse(w, r, bindError(err))
+		return
+	}
+	if len(reqs) == 0 {
+		h.problemResponse(w, r, newError(http.StatusBadRequest, CodeInvalidBody, "no operations", nil))
+		return
+	}
+	if len(reqs) > maxBulkOperations {
+		detail := fmt.Sprintf("too many operations, the maximum is %d", maxBulkOperations)
+		h.problemResponse(w, r, newError(http.StatusRequestEntityTooLarge, statusCode(http.StatusRequestEntityTooLarge), detail, nil))
+		return
+	}
+
+	res := &SampleBulkResponse{Items: make([]*SampleBulkResult, len(reqs))}
+	ops := make([]*mysql.BulkOperation, 0, len(reqs))
+	// index maps ops to the items of the response
+	index := make([]int, 0, len(reqs))
+	for i, req := range reqs {
+		res.Items[i] = &SampleBulkResult{Op: req.Op, ID: req.ID}
+		op, err := bulkOperation(r, req)
+		if err != nil {
+			res.Items[i].setError(toError(err))
+			res.Errors = true
+			continue
+		}
+		ops = append(ops, op)
+		index = append(index, i)
+	}
+
+	if atomic && res.Errors {
+		for _, item := range res.Items {
+			if item.Status == 0 {
+				item.setError(bulkResultError(mysql.ErrRolledBack))
+			}
+		}
+		h.negotiatedResponse(w, r, http.StatusUnprocessableEntity, res)
+		return
+	}
+
+	results := []*mysql.BulkResult{}
+	if len(ops) > 0 {
+		sc := mysql.NewSample(h.Mysql)
+		results, err = sc.BulkSample(ctx, ops, atomic)
+		if err != nil {
+			h.problemResponse(w, r, err)
+			return
+		}
+	}
+
+	tags := []string{}
+	changed := false
+	for k, result := range results {
+		item := res.Items[index[k]]
+		item.ID = result.ID
+		if result.Err != nil {
+			e := bulkResultError(result.Err)
+			if e.Status >= http.StatusInternalServerError {
+				h.logger(r.Context()).Error(result.Err.Error())
+			}
+			item.setError(e)
+			res.Errors = true
+			continue
+		}
+		item.Status = http.StatusOK
+		if item.Op == mysql.BulkCreate {
+			item.Status = http.StatusCreated
+		}
+		changed = true
+		if item.Op != mysql.BulkCreate {
+			tags = append(tags, sampleTag(item.ID))
+		}
+	}
+
+	if atomic && res.Errors {
+		h.negotiatedResponse(w, r, http.StatusUnprocessableEntity, res)
+		return
+	}
+
+	if changed {
+		tags = append(tags, sampleListTag)
+		h.goSafe(r.Context(), func() {
+			// purge cache once for the whole bulk
+			h.purgeCacheTags(detachContext(r.Context()), tags...)
+		})
+	}
+
+	h.negotiatedResponse(w, r, http.StatusOK, res)
+}
+
+// decodeBulkOperations reads a JSON array of operations, or one operation per line when ndjson is true
+func decodeBulkOperations(body io.Reader, ndjson bool) ([]*SampleBulkOperation, error) {
+	dec := json.NewDecoder(body)
+	reqs := []*SampleBulkOperation{}
+
+	if !ndjson {
+		if err := dec.Decode(&reqs); err != nil {
+			return nil, err
+		}
+		if dec.More() {
+			return nil, errors.New("unexpected data after the array")
+		}
+		return reqs, nil
+	}
+
+	for {
+		req := &SampleBulkOperation{}
+		err := dec.Decode(req)
+		if err == io.EOF {
+			return reqs, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", len(reqs)+1, err)
+		}
+		reqs = append(reqs, req)
+		if len(reqs) > maxBulkOperations {
+			return reqs, nil
+		}
+	}
+}
+
+// errMissingBulkID is the error of an operation without the id of the record
+var errMissingBulkID = validationError(&FieldError{Field: "id", Code: "required", Message: "missing required field"})
+
+// bulkOperation validates an operation of the request and converts it for the storage.
+// The errors are Error of the status 400.
+func bulkOperation(r *http.Request, req *SampleBulkOperation) (*mysql.BulkOperation, error) {
+	switch req.Op {
+	case mysql.BulkCreate:
+		data := &SamplePostRequest{}
+		if err := decodeJSON(bytes.NewReader(req.Data), data); err != nil {
+			return nil, bindError(err)
+		}
+		if err := data.Bind(r); err != nil {
+			return nil, err
+		}
+		return &mysql.BulkOperation{
+			Op:     req.Op,
+			Sample: &mysql.SampleData{Foo: data.Foo, IntVal: data.IntVal},
+		}, nil
+	case mysql.BulkUpdate:
+		if req.ID <= 0 {
+			return nil, errMissingBulkID
+		}
+		if len(req.Data) == 0 {
+			return nil, validationError(&FieldError{Field: "data", Code: "required", Message: "missing required field"})
+		}
+		d := &mysql.SampleData{}
+		doc, err := newPatchDocument(d, sampleWritableMembers)
+		if err == nil {
+			err = doc.applyMergePatch(bytes.NewReader(req.Data))
+		}
+		if err != nil {
+			return nil, patchError(err)
+		}
+		fields, err := decodeSamplePatch(doc, d)
+		if err != nil {
+			return nil, err
+		}
+		d.Version = req.Version
+		return &mysql.BulkOperation{Op: req.Op, ID: req.ID, Sample: d, Fields: fields}, nil
+	case mysql.BulkDelete:
+		if req.ID <= 0 {
+			return nil, errMissingBulkID
+		}
+		return &mysql.BulkOperation{Op: req.Op, ID: req.ID}, nil
+	default:
+		return nil, validationError(&FieldError{Field: "op", Code: "enum", Message: fmt.Sprintf("must be one of %s, %s, %s", mysql.BulkCreate, mysql.BulkUpdate, mysql.BulkDelete)})
+	}
+}
+
+// bulkResultError converts the error of an operation. Unlike a single update,
+// the version of an operation isn't from If-Match, so a conflict is 409.
+func bulkResultError(err error) *Error {
+	switch {
+	case errors.Is(err, mysql.ErrRolledBack):
+		return newError(http.StatusFailedDependency, statusCode(http.StatusFailedDependency), "another operation failed", err)
+	case errors.Is(err, mysql.ErrVersionConflict):
+		return newError(http.StatusConflict, CodeVersionConflict, "the resource has been modified", err)
+	}
+	return toError(err)
+}
@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDecodeBulkOperations(t *testing.T) {
+	type testCase struct {
+		Scenario string
+		Body     string
+		NDJSON   bool
+		Expected []string
+		Err      bool
+	}
+	testCases := []testCase{
+		{"array", `[{"op": "create", "data": {"foo": "a"}}, {"op": "delete", "id": 1}]`, false, []string{"create", "delete"}, false},
+		{"ndjson", "{\"op\": \"create\", \"data\": {\"foo\": \"a\"}}\n{\"op\": \"delete\", \"id\": 1}\n", true, []string{"create", "delete"}, false},
+		{"trailing data after the array", `[{"op": "delete", "id": 1}] {}`, false, nil, true},
+		{"broken line", "{\"op\": \"delete\", \"id\": 1}\n{\"op\": \n", true, nil, true},
+	}
+
+	for _, tc := range testCases {
+		reqs, err := decodeBulkOperations(strings.NewReader(tc.Body), tc.NDJSON)
+		if (err != nil) != tc.Err {
+			t.Errorf("%s: test failed, got: %v, want error: %v", tc.Scenario, err, tc.Err)
+			continue
+		}
+		var got []string
+		for _, req := range reqs {
+			got = append(got, req.Op)
+		}
+		if !reflect.DeepEqual(got, tc.Expected) {
+			t.Errorf("%s: test failed, got: %v, want: %v", tc.Scenario, got, tc.Expected)
+		}
+	}
+}
+
+func TestSampleBulkHandlerInvalid(t *testing.T) {
+	h, _ := newTestHandler(t)
+
+	// an invalid operation fails the whole bulk before touching the database
+	body := `[{"op": "create", "data": {"foo": "a"}}, {"op": "create", "data": {"int_val": 1}}, {"op": "update", "id": 1, "data": {"id": 2}}, {"op": "move", "id": 1},
+		{"op": "update", "id": 1, "data": {"foo": "` + strings.Repeat("a", 256) + `"}}]`
+	r := httptest.NewRequest(http.MethodPost, "/sample/_bulk", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	h.SampleBulkHandler(w, r)
+
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("test failed, got: %v, want: %v", w.Code, http.StatusUnprocessableEntity)
+	}
+	res := &SampleBulkResponse{}
+	if err := json.Unmarshal(w.Body.Bytes(), res); err != nil {
+		t.Fatal(err)
+	}
+	want := []int{http.StatusFailedDependency, http.StatusBadRequest, http.StatusBadRequest, http.StatusBadRequest, http.StatusBadRequest}
+	got := []int{}
+	for _, item := range res.Items {
+		got = append(got, item.Status)
+	}
+	if !res.Errors || !reflect.DeepEqual(got, want) {
+		t.Errorf("test failed, got: %v, want: %v", got, want)
+	}
+
+	// the problems of the operations are reported as problem details are
+	wantErrors := []string{"", "foo:required", "", "op:enum", "foo:maxlen"}
+	gotErrors := []string{}
+	for _, item := range res.Items {
+		e := ""
+		for _, f := range item.Errors {
+			e += f.Field + ":" + f.Code
+		}
+		gotErrors = append(gotErrors, e)
+	}
+	if !reflect.DeepEqual(gotErrors, wantErrors) {
+		t.Errorf("test failed, got: %v, want: %v", gotErrors, wantErrors)
+	}
+}
@@ -0,0 +1,59 @@
+package handler
+
+import (
+	"io"
+	"net/http"
+	"reflect"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// CBOR, RFC 8949. The members have the names of JSON, and time.Time is a RFC 3339 text string of tag 0.
+
+var (
+	cborEncMode = mustCBOREncMode(cbor.EncOptions{
+		Time:    cbor.TimeRFC3339Nano,
+		TimeTag: cbor.EncTagRequired,
+	})
+	// the maps of a request body are objects of JSON
+	cborDecMode = mustCBORDecMode(cbor.DecOptions{
+		MaxNestedLevels: maxTreeDepth,
+		DefaultMapType:  reflect.TypeOf(map[string]interface{}(nil)),
+	})
+)
+
+func mustCBOREncMode(opts cbor.EncOptions) cbor.EncMode {
+	em, err := opts.EncMode()
+	if err != nil {
+		panic(err)
+	}
+	return em
+}
+
+func mustCBORDecMode(opts cbor.DecOptions) cbor.DecMode {
+	dm, err := opts.DecMode()
+	if err != nil {
+		panic(err)
+	}
+	return dm
+}
+
+// encodeCBOR encodes v by the json tags of its fields
+func encodeCBOR(w io.Writer, v interface{}) error {
+	return cborEncMode.NewEncoder(w).Encode(v)
+}
+
+// decodeCBOR decodes a CBOR request body into v as if it was JSON, see decodeJSON
+func decodeCBOR(body io.Reader, v interface{}) error {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+
+	var tree interface{}
+	if err := cborDecMode.Unmarshal(data, &tree); err != nil {
+		return newError(http.StatusBadRequest, CodeInvalidBody, "the body is not valid CBOR: "+err.Error(), err)
+	}
+
+	return decodeTree(tree, v)
+}
@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/hex"
+	"net/http"
+	"testing"
+	"time"
+
+	mysql "github.com/sunao-uehara/go-restapi-sample/storages/mysql"
+)
+
+func TestEncodeCBOR(t *testing.T) {
+	created := time.Date(2013, 3, 21, 20, 4, 0, 0, time.UTC)
+
+	type testCase struct {
+		Scenario string
+		Value    interface{}
+		Hex      string
+	}
+	testCases := []testCase{
+		{"names of json", &ListLinks{Next: "a"}, "a1646e6578746161"},
+		// 0("2013-03-21T20:04:00Z"), RFC 8949 Appendix A
+		{"time", created, "c074323031332d30332d32315432303a30343a30305a"},
+		{"ints", []int64{23, 1000000, -100}, "83171a000f42403863"},
+	}
+
+	for _, tc := range testCases {
+		var buf bytes.Buffer
+		if err := encodeCBOR(&buf, tc.Value); err != nil {
+			t.Errorf("%s: expected non error, but some error occurred, %s", tc.Scenario, err.Error())
+			continue
+		}
+		if got := hex.EncodeToString(buf.Bytes()); got != tc.Hex {
+			t.Errorf("%s: test failed, got: %v, want: %v", tc.Scenario, got, tc.Hex)
+		}
+	}
+}
+
+func TestDecodeCBOR(t *testing.T) {
+	type testCase struct {
+		Scenario string
+		Hex      string
+		Code     ErrorCode
+	}
+	testCases := []testCase{
+		// {"foo": "a", "int_val": 1}
+		{"valid", "a263666f6f616167696e745f76616c01", ""},
+		{"indefinite map", "bf63666f6f616167696e745f76616c01ff", ""},
+		{"unknown field", "a263666f6f616163626172f6", CodeValidationFailed},
+		{"trailing data", "a163666f6f616101", CodeInvalidBody},
+		{"truncated", "a263666f6f", CodeInvalidBody},
+		{"non text key", "a10102", CodeInvalidBody},
+		{"infinity", "a163666f6ff97c00", CodeInvalidBody},
+		{"length longer than the data", "9bffffffffffffffff", CodeInvalidBody},
+	}
+
+	for _, tc := range testCases {
+		data, _ := hex.DecodeString(tc.Hex)
+		req := &SamplePostRequest{}
+		err := decodeCBOR(bytes.NewReader(data), req)
+		if tc.Code == "" {
+			if err != nil {
+				t.Errorf("%s: expected non error, but some error occurred, %s", tc.Scenario, err.Error())
+			} else if req.Foo != "a" || req.IntVal != 1 {
+				t.Errorf("%s: test failed, got: %+v", tc.Scenario, req)
+			}
+			continue
+		}
+
+		e := bindError(err)
+		if e.Code != tc.Code || e.Status != http.StatusBadRequest {
+			t.Errorf("%s: test failed, got: %v %v, want: %v %v", tc.Scenario, e.Status, e.Code, http.StatusBadRequest, tc.Code)
+		}
+	}
+}
+
+func TestCBORRoundTrip(t *testing.T) {
+	created := time.Date(2021, 11, 1, 10, 0, 0, 0, time.UTC)
+	sample := &mysql.SampleData{ID: 1, Foo: "a", IntVal: -5, Version: 2, CreatedAt: created, UpdatedAt: created}
+
+	var buf bytes.Buffer
+	if err := encodeCBOR(&buf, sample); err != nil {
+		t.Fatalf("expected non error, but some error occurred, %s", err.Error())
+	}
+	got := &mysql.SampleData{}
+	if err := cborDecMode.Unmarshal(buf.Bytes(), got); err != nil {
+		t.Fatalf("expected non error, but some error occurred, %s", err.Error())
+	}
+	if *got != *sample {
+		t.Errorf("test failed, got: %+v, want: %+v", got, sample)
+	}
+}
@@ -0,0 +1,96 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strings"
+)
+
+// listRows is implemented by the list responses which have the rows in a member,
+// so that the rows can be presented in CSV
+type listRows interface {
+	rows() interface{}
+}
+
+// encodeCSV encodes a list of objects as a CSV table with a header row, the columns are the members
+// in the order of JSON. Nested arrays and objects are JSON in a cell.
+// Other values are errNotEncodable.
+func encodeCSV(w io.Writer, v interface{}) error {
+	if l, ok := v.(listRows); ok {
+		v = l.rows()
+	}
+	tree, err := toTree(v)
+	if err != nil {
+		return err
+	}
+	items, ok := tree.([]interface{})
+	if !ok {
+		return errNotEncodable
+	}
+
+	// a member missing in the first rows is appended to the columns
+	columns := []string{}
+	seen := map[string]bool{}
+	for _, item := range items {
+		o, ok := item.(*object)
+		if !ok {
+			return errNotEncodable
+		}
+		for _, k := range o.keys {
+			if !seen[k] {
+				seen[k] = true
+				columns = append(columns, k)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	cw := csv.NewWriter(&buf)
+	if len(items) > 0 {
+		cw.Write(columns)
+	}
+	for _, item := range items {
+		o := item.(*object)
+		record := make([]string, 0, len(columns))
+		for _, k := range columns {
+			cell, err := csvCell(o.values[k])
+			if err != nil {
+				return err
+			}
+			record = append(record, cell)
+		}
+		cw.Write(record)
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return err
+	}
+
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+func csvCell(v interface{}) (string, error) {
+	switch t := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		// a spreadsheet runs a cell which looks like a formula, CSV injection
+		if t != "" && strings.ContainsRune("=+-@\t\r", rune(t[0])) {
+			return "'" + t, nil
+		}
+		return t, nil
+	case json.Number:
+		return string(t), nil
+	case bool:
+		if t {
+			return "true", nil
+		}
+		return "false", nil
+	}
+
+	b, err := json.Marshal(v)
+	return string(b), err
+}
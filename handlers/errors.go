@@ -0,0 +1,223 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	driver "github.com/go-sql-driver/mysql"
+
+	mysql "github.com/sunao-uehara/go-restapi-sample/storages/mysql"
+)
+
+// contentTypeProblem is the media type of problem details, RFC 7807
+const contentTypeProblem = "application/problem+json"
+
+// ErrorCode is the stable, machine-readable identifier of a problem, it's also the last part of the problem type
+type ErrorCode string
+
+// the codes which are not only the status. The others are derived from the status, e.g. not_found, see statusCode
+const (
+	CodeInvalidBody      ErrorCode = "invalid_body"
+	CodeValidationFailed ErrorCode = "validation_failed"
+	CodeInvalidParameter ErrorCode = "invalid_parameter"
+	CodeDuplicate        ErrorCode = "duplicate"
+	CodeVersionConflict  ErrorCode = "version_conflict"
+	CodeTimeout          ErrorCode = "timeout"
+)
+
+// the codes derived from the status which are used by the handlers
+var (
+	CodeNotFound           = statusCode(http.StatusNotFound)
+	CodeConflict           = statusCode(http.StatusConflict)
+	CodePreconditionFailed = statusCode(http.StatusPreconditionFailed)
+	CodeInternal           = statusCode(http.StatusInternalServerError)
+)
+
+// statusCode is the code of a problem which has no more meaning than the status, e.g. 404 is not_found
+func statusCode(status int) ErrorCode {
+	return ErrorCode(strings.ToLower(strings.ReplaceAll(http.StatusText(status), " ", "_")))
+}
+
+// Error is an error which knows how it's presented to the client.
+// Err is the cause, it's logged but never sent to the client.
+type Error struct {
+	Status int
+	Code   ErrorCode
+	Detail string
+	Fields []*FieldError
+	Err    error
+}
+
+// FieldError is a validation error of a field of the request
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	msg := string(e.Code)
+	if e.Detail != "" {
+		msg += ": " + e.Detail
+	}
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is makes errors.Is match any Error with the same code, e.g. errors.Is(err, &Error{Code: CodeNotFound})
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+func newError(status int, code ErrorCode, detail string, err error) *Error {
+	return &Error{Status: status, Code: code, Detail: detail, Err: err}
+}
+
+func invalidParameterError(detail string, err error) *Error {
+	return newError(http.StatusBadRequest, CodeInvalidParameter, detail, err)
+}
+
+func internalError(err error) *Error {
+	return newError(http.StatusInternalServerError, CodeInternal, "", err)
+}
+
+// validationError reports the invalid fields of the request
+func validationError(fields ...*FieldError) *Error {
+	return &Error{
+		Status: http.StatusBadRequest,
+		Code:   CodeValidationFailed,
+		Detail: "the request has invalid fields",
+		Fields: fields,
+	}
+}
+
+// MySQL error numbers which are caused by the request rather than the server
+const (
+	mysqlErrDupEntry        = 1062
+	mysqlErrDataTooLong     = 1406
+	mysqlErrOutOfRange      = 1264
+	mysqlErrRowIsReferenced = 1451
+	mysqlErrNoReferencedRow = 1452
+	mysqlErrTruncatedValue  = 1366
+)
+
+// toError converts any error into Error, storage errors are mapped to their status
+func toError(err error) *Error {
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+
+	var me *driver.MySQLError
+	switch {
+	case errors.Is(err, sql.ErrNoRows), errors.Is(err, mysql.ErrNotFound):
+		return newError(http.StatusNotFound, CodeNotFound, "the resource doesn't exist", err)
+	case errors.Is(err, mysql.ErrVersionConflict):
+		return newError(http.StatusPreconditionFailed, CodeVersionConflict, "the resource has been modified", err)
+	case errors.Is(err, mysql.ErrUnknownColumn), errors.Is(err, mysql.ErrUnknownOperator), errors.Is(err, mysql.ErrInvalidCursor):
+		// these are built from the parameters of the request, so the message is safe to show
+		return invalidParameterError(err.Error(), err)
+	case errors.Is(err, context.DeadlineExceeded):
+		return newError(http.StatusGatewayTimeout, CodeTimeout, "the request took too long", err)
+	case errors.As(err, &me):
+		switch me.Number {
+		case mysqlErrDupEntry:
+			return newError(http.StatusConflict, CodeDuplicate, "the resource already exists", err)
+		case mysqlErrRowIsReferenced, mysqlErrNoReferencedRow:
+			return newError(http.StatusConflict, CodeConflict, "the resource is referenced by or refers to another one", err)
+		case mysqlErrDataTooLong, mysqlErrOutOfRange, mysqlErrTruncatedValue:
+			return newError(http.StatusBadRequest, CodeValidationFailed, "a value is out of range", err)
+		}
+	}
+
+	return internalError(err)
+}
+
+// bindError converts an error of bindRequest, the request body is either broken or invalid
+func bindError(err error) *Error {
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	var mbe *http.MaxBytesError
+	switch {
+	case errors.As(err, &typeErr):
+		return validationError(&FieldError{
+			Field:   typeErr.Field,
+			Code:    "invalid_type",
+			Message: fmt.Sprintf("must be %s", typeErr.Type),
+		})
+	case errors.As(err, &syntaxErr), errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return newError(http.StatusBadRequest, CodeInvalidBody, "the body is not valid JSON", err)
+	case errors.As(err, &mbe):
+		return newError(http.StatusRequestEntityTooLarge, statusCode(http.StatusRequestEntityTooLarge), "the body is too large", err)
+	}
+
+	return newError(http.StatusBadRequest, CodeInvalidBody, err.Error(), err)
+}
+
+// Problem is the body of an error response, RFC 7807.
+// Code and Errors are extension members.
+type Problem struct {
+	Type     string        `json:"type"`
+	Title    string        `json:"title"`
+	Status   int           `json:"status"`
+	Detail   string        `json:"detail,omitempty"`
+	Instance string        `json:"instance,omitempty"`
+	Code     ErrorCode     `json:"code"`
+	Errors   []*FieldError `json:"errors,omitempty"`
+}
+
+func newProblem(e *Error) *Problem {
+	return &Problem{
+		Type:   problemType(e.Code),
+		Title:  http.StatusText(e.Status),
+		Status: e.Status,
+		Detail: e.Detail,
+		Code:   e.Code,
+		Errors: e.Fields,
+	}
+}
+
+// problemType is the URI identifying the type of problems with code
+func problemType(code ErrorCode) string {
+	return "urn:problem-type:" + string(code)
+}
+
+// problemResponse responds err as problem details. Errors other than Error are 500 unless they are known storage errors.
+func (h *Handler) problemResponse(w http.ResponseWriter, r *http.Request, err error) {
+	e := toError(err)
+	if e.Status >= http.StatusInternalServerError {
+		h.logger(r.Context()).Error(err.Error())
+	} else {
+		h.logger(r.Context()).Debug(err)
+	}
+
+	p := newProblem(e)
+	p.Instance = r.URL.RequestURI()
+	writeProblem(w, p)
+}
+
+func writeProblem(w http.ResponseWriter, p *Problem) {
+	b, _ := json.Marshal(p)
+
+	w.Header().Set("Content-Type", contentTypeProblem)
+	w.WriteHeader(p.Status)
+	w.Write(b)
+}
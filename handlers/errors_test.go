@@ -0,0 +1,123 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	driver "github.com/go-sql-driver/mysql"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+
+	mysql "github.com/sunao-uehara/go-restapi-sample/storages/mysql"
+)
+
+func TestToError(t *testing.T) {
+	type testCase struct {
+		Scenario string
+		Err      error
+		Status   int
+		Code     ErrorCode
+	}
+	testCases := []testCase{
+		{"no rows", fmt.Errorf("get: %w", sql.ErrNoRows), http.StatusNotFound, "not_found"},
+		{"duplicate key", &driver.MySQLError{Number: 1062, Message: "Duplicate entry"}, http.StatusConflict, CodeDuplicate},
+		{"version conflict", mysql.ErrVersionConflict, http.StatusPreconditionFailed, CodeVersionConflict},
+		{"unknown column", fmt.Errorf("%w: bar", mysql.ErrUnknownColumn), http.StatusBadRequest, CodeInvalidParameter},
+		{"timeout", context.DeadlineExceeded, http.StatusGatewayTimeout, CodeTimeout},
+		{"typed error", validationError(), http.StatusBadRequest, CodeValidationFailed},
+		{"unknown error", errors.New("connection refused"), http.StatusInternalServerError, "internal_server_error"},
+	}
+
+	for _, tc := range testCases {
+		e := toError(tc.Err)
+		if e.Status != tc.Status || e.Code != tc.Code {
+			t.Errorf("%s: test failed, got: %v, %v, want: %v, %v", tc.Scenario, e.Status, e.Code, tc.Status, tc.Code)
+		}
+		if !errors.Is(e, &Error{Code: tc.Code}) {
+			t.Errorf("%s: test failed, errors.Is doesn't match the code", tc.Scenario)
+		}
+	}
+}
+
+func TestBindError(t *testing.T) {
+	type testCase struct {
+		Scenario string
+		Body     string
+		Code     ErrorCode
+		Field    string
+	}
+	testCases := []testCase{
+		{"broken json", `{"foo": `, CodeInvalidBody, ""},
+		{"wrong type", `{"foo": "a", "int_val": "abc"}`, CodeValidationFailed, "int_val"},
+	}
+
+	for _, tc := range testCases {
+		req := &SamplePostRequest{}
+		e := bindError(json.NewDecoder(strings.NewReader(tc.Body)).Decode(req))
+		if e.Code != tc.Code {
+			t.Errorf("%s: test failed, got: %v, want: %v", tc.Scenario, e.Code, tc.Code)
+		}
+		if tc.Field != "" && (len(e.Fields) != 1 || e.Fields[0].Field != tc.Field) {
+			t.Errorf("%s: test failed, got: %v, want: %v", tc.Scenario, e.Fields, tc.Field)
+		}
+	}
+}
+
+func TestProblemResponse(t *testing.T) {
+	h, _ := newTestHandler(t)
+
+	r := httptest.NewRequest(http.MethodDelete, "/sample/abc?x=1", nil)
+	w := httptest.NewRecorder()
+	h.problemResponse(w, r, invalidParameterError("sampleId must be an integer", nil))
+
+	if w.Code != http.StatusBadRequest || w.Header().Get("Content-Type") != contentTypeProblem {
+		t.Fatalf("test failed, got: %v, %v", w.Code, w.Header().Get("Content-Type"))
+	}
+	got := &Problem{}
+	if err := json.Unmarshal(w.Body.Bytes(), got); err != nil {
+		t.Fatal(err)
+	}
+	want := &Problem{
+		Type:     "urn:problem-type:invalid_parameter",
+		Title:    "Bad Request",
+		Status:   http.StatusBadRequest,
+		Detail:   "sampleId must be an integer",
+		Instance: "/sample/abc?x=1",
+		Code:     CodeInvalidParameter,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("test failed, got: %v, want: %v", got, want)
+	}
+}
+
+func TestProblemResponseLogLevel(t *testing.T) {
+	core, logs := observer.New(zap.ErrorLevel)
+	h := NewHandler(&HandlerOptions{Log: zap.New(core).Sugar()})
+
+	type testCase struct {
+		Scenario string
+		Err      error
+		Logged   int
+	}
+	testCases := []testCase{
+		{"server error", errors.New("broken"), 1},
+		{"client error", mysql.ErrNotFound, 0},
+	}
+
+	for _, tc := range testCases {
+		logs.TakeAll()
+		r := httptest.NewRequest(http.MethodGet, "/sample/1", nil)
+		h.problemResponse(httptest.NewRecorder(), r, tc.Err)
+		if got := logs.Len(); got != tc.Logged {
+			t.Errorf("%s: test failed, got: %v, want: %v", tc.Scenario, got, tc.Logged)
+		}
+	}
+}
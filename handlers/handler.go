@@ -7,33 +7,80 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
-	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/go-redis/redis/v8"
 	_ "github.com/go-sql-driver/mysql"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 
-	chi "github.com/go-chi/chi/v5"
-	"github.com/go-chi/render"
+	"go.opentelemetry.io/otel/attribute"
 	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
 
+	"github.com/sunao-uehara/go-restapi-sample/analytics"
+	"github.com/sunao-uehara/go-restapi-sample/storages/lru"
 	mysql "github.com/sunao-uehara/go-restapi-sample/storages/mysql"
 	myRedis "github.com/sunao-uehara/go-restapi-sample/storages/redis"
 )
 
 type Handler struct {
 	*HandlerOptions
+
+	// cacheGroup coalesces concurrent loads of the same cache key
+	cacheGroup singleflight.Group
+	// refreshing is the set of cache keys being revalidated in background
+	refreshMu  sync.Mutex
+	refreshing map[string]bool
+	// stats is the request metrics recorded by StatsMiddleware
+	stats *requestStats
+	// metricsHandler serves Metrics, see MetricsHandler
+	metricsHandler http.Handler
 }
 type HandlerOptions struct {
 	Wg    *sync.WaitGroup
 	Mysql *sql.DB
 	Redis *redis.Client
 	Log   *zap.SugaredLogger
+	// CacheVary is the list of request headers which are a part of the cache key, defaultCacheVary is used when nil
+	CacheVary []string
+	// CacheFreshFor is how long a cached response is served without revalidation, defaultCacheFreshFor is used when zero
+	CacheFreshFor time.Duration
+	// CacheTTL is how long a cached response is kept in Redis, stale responses are served until then.
+	// myRedis.DefaultCacheTTL is used when zero
+	CacheTTL time.Duration
+	// LocalCache is the in-process tier checked before Redis, it's disabled when nil
+	LocalCache *lru.Cache
+	// LocalCacheTTL is how long a response is kept in LocalCache, defaultLocalCacheTTL is used when zero
+	LocalCacheTTL time.Duration
+	// Metrics is the registry of the request metrics served by MetricsHandler. When it's nil, a new one is used
+	// with the Go runtime and process metrics. The global prometheus.DefaultRegisterer is not used,
+	// so that every Handler, e.g. of a test, has its own metrics.
+	Metrics *prometheus.Registry
+	// Analytics is the pipeline of the request events emitted by StatsMiddleware, it's disabled when nil.
+	// See StartAnalytics
+	Analytics *analytics.Pipeline
+	// IdempotencyTTL is how long a response is replayed for Idempotency-Key, myRedis.DefaultIdempotencyTTL is used when zero
+	IdempotencyTTL time.Duration
 }
 
 func NewHandler(handlerOptions *HandlerOptions) *Handler {
+	if handlerOptions.Metrics == nil {
+		handlerOptions.Metrics = prometheus.NewRegistry()
+		handlerOptions.Metrics.MustRegister(
+			collectors.NewGoCollector(),
+			collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		)
+	}
+
 	return &Handler{
-		handlerOptions,
+		HandlerOptions: handlerOptions,
+		refreshing:     map[string]bool{},
+		stats:          newRequestStats(handlerOptions.Metrics),
+		metricsHandler: promhttp.HandlerFor(handlerOptions.Metrics, promhttp.HandlerOpts{}),
 	}
 }
 
@@ -43,26 +90,21 @@ func (h *Handler) IndexHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 type SamplePostRequest struct {
-	Foo    string `json:"foo"`
-	IntVal int64  `json:"int_val"`
+	Foo    string `json:"foo" xml:"foo" validate:"required,maxlen=255"`
+	IntVal int64  `json:"int_val" xml:"int_val" validate:"min=-2147483648,max=2147483647"`
 }
 
 func (spr *SamplePostRequest) Bind(r *http.Request) error {
-	if spr.Foo == "" {
-		return errors.New("missin required field: Foo")
-	}
-
 	return nil
 }
 
 func (h *Handler) SamplePostHandler(w http.ResponseWriter, r *http.Request) {
-	h.Log.Debug("SamplePostHandler")
-	// ctx := r.Context()
+	h.logger(r.Context()).Debug("SamplePostHandler")
+	ctx := r.Context()
 
 	req := &SamplePostRequest{}
-	if err := render.Bind(r, req); err != nil {
-		h.Log.Info(err.Error())
-		errorJSONResponse(w, http.StatusBadRequest, "cannot create record")
+	if err := bindRequest(r, req); err != nil {
+		h.problemResponse(w, r, bindError(err))
 		return
 	}
 	// h.Log.Debugf("param foo: %s", req.Foo)
@@ -70,161 +112,421 @@ func (h *Handler) SamplePostHandler(w http.ResponseWriter, r *http.Request) {
 
 	// write the data into MySQL
 	sc := mysql.NewSample(h.Mysql)
-	id, err := sc.CreateSample(&mysql.SampleData{Foo: req.Foo, IntVal: req.IntVal})
+	id, err := sc.CreateSample(ctx, &mysql.SampleData{Foo: req.Foo, IntVal: req.IntVal})
 	if err != nil {
-		h.Log.Info(err.Error())
-		errorJSONResponse(w, http.StatusInternalServerError, "cannot create record")
+		h.problemResponse(w, r, err)
+		return
 	}
 
-	h.Wg.Add(1)
-	go func() {
-		defer h.Wg.Done()
-
+	h.goSafe(r.Context(), func() {
 		// purge cache
-		h.purgeCache(context.Background(), []string{"/sample", "/sample/"})
-	}()
+		h.purgeCacheTags(detachContext(r.Context()), sampleListTag)
+	})
 
-	type Res struct {
-		ID int64 `json:"id"`
+	// read it again for the version and the timestamps. The record is created anyway,
+	// so a failure here is not an error of the request, the client gets what it sent.
+	d, err := sc.GetSample(ctx, id)
+	if err != nil {
+		h.logger(r.Context()).Warn(err.Error())
+		d = &mysql.SampleData{ID: id, Foo: req.Foo, IntVal: req.IntVal, Version: 1}
 	}
-	res := &Res{id}
-	successJSONResponse(w, res)
+
+	w.Header().Set("Location", fmt.Sprintf("/sample/%d", id))
+	h.versionedResponse(w, r, http.StatusCreated, d, d.Version, time.Time{})
+}
+
+// errMissingSampleID is the error when the route doesn't parse sampleId with PathParams
+var errMissingSampleID = invalidParameterError("missing sampleId", nil)
+
+// sampleListTag is the cache tag of every list of samples
+const sampleListTag = "sample:list"
+
+// sampleTag is the cache tag of every response which contains the sample
+func sampleTag(id int64) string {
+	return fmt.Sprintf("sample:%d", id)
+}
+
+// SampleListResponse is the response of GET /sample
+type SampleListResponse struct {
+	Data  []*mysql.SampleData `json:"data" xml:"data>item"`
+	Total int64               `json:"total" xml:"total"`
+	Links *ListLinks          `json:"links" xml:"links,omitempty"`
+}
+
+func (res *SampleListResponse) rows() interface{} {
+	return res.Data
 }
 
 func (h *Handler) SampleGetHandler(w http.ResponseWriter, r *http.Request) {
-	h.Log.Debug("SampleGetHandler")
-	// ctx := r.Context()
+	h.logger(r.Context()).Debug("SampleGetHandler")
+	ctx := r.Context()
 
-	sampleId := chi.URLParam(r, "sampleId")
-	if sampleId != "" {
-		id, _ := strconv.ParseInt(sampleId, 10, 64)
+	if id, ok := pathInt64(r, "sampleId"); ok {
 
 		// get the data from mysql
 		sc := mysql.NewSample(h.Mysql)
-		data, err := sc.GetSample(id)
+		data, err := sc.GetSample(ctx, id)
 		if err != nil {
-			h.Log.Debug(err)
-			errorJSONResponse(w, http.StatusNotFound, "Not Found")
+			h.problemResponse(w, r, err)
 			return
 		}
-		h.Log.Debug(data)
+		h.logger(r.Context()).Debug(data)
 
-		// execute asynchronously
-		h.Wg.Add(1)
-		go func() {
-			h.Log.Debug("sample goroutine start")
-			defer h.Wg.Done()
-
-			// wait X seconds for testing graceful shutdown for goroutine
-			// time.Sleep(3 * time.Second)
-
-			// write the data into Redis
-			h.setCache(context.Background(), r.URL.Path, data)
-			h.Log.Debug("sample goroutine done")
-		}()
-
-		successJSONResponse(w, data)
+		setCacheTags(w, sampleTag(id))
+		h.versionedResponse(w, r, http.StatusOK, data, data.Version, data.UpdatedAt)
 		return
 	}
 
 	sc := mysql.NewSample(h.Mysql)
-	data, err := sc.GetManySample()
+	var rows []*mysql.SampleData
+	page, err := listCollection(r, func(ctx context.Context, opts *mysql.ListOptions) ([]int64, error) {
+		var err error
+		rows, err = sc.ListSample(ctx, opts)
+		ids := make([]int64, 0, len(rows))
+		for _, d := range rows {
+			ids = append(ids, d.ID)
+		}
+		return ids, err
+	}, sc.CountSample)
 	if err != nil {
-		h.Log.Debug(err)
-		errorJSONResponse(w, http.StatusNotFound, "Not Found")
+		h.problemResponse(w, r, err)
 		return
 	}
+	data := &SampleListResponse{
+		Data:  rows[page.start:page.end],
+		Total: page.total,
+		Links: page.links,
+	}
 
-	// execute asynchronously
-	h.Wg.Add(1)
-	go func() {
-		defer h.Wg.Done()
-		h.setCache(context.Background(), r.URL.Path, data)
-	}()
-
-	successJSONResponse(w, data)
+	setCacheTags(w, sampleListTag)
+	h.negotiatedResponse(w, r, http.StatusOK, data)
 }
 
 type SamplePatchRequest struct {
-	Foo    string `json:"foo,omitempty"`
-	IntVal int64  `json:"int_val,omitempty"`
+	Foo    string `json:"foo,omitempty" xml:"foo" validate:"maxlen=255"`
+	IntVal int64  `json:"int_val,omitempty" xml:"int_val" validate:"min=-2147483648,max=2147483647"`
 }
 
 func (spr *SamplePatchRequest) Bind(r *http.Request) error {
 	if spr.Foo == "" && spr.IntVal == 0 {
-		return errors.New("missing patch fields")
+		return newError(http.StatusBadRequest, CodeInvalidBody, "missing patch fields", nil)
 	}
 
 	return nil
 }
 
-func (h *Handler) SamplePatchHandler(w http.ResponseWriter, r *http.Request) {
-	h.Log.Debug("SamplePatchHandler")
+// sampleWritableMembers is the list of members of SampleData which a patch can modify, with their zero values
+var sampleWritableMembers = map[string]json.RawMessage{
+	"foo":     json.RawMessage(`""`),
+	"int_val": json.RawMessage(`0`),
+}
 
+// decodeSamplePatch stores the writable members of the patched doc into d, and validates them with the rules
+// of SamplePatchRequest as the other bodies are. It returns the members which were modified.
+func decodeSamplePatch(doc *patchDocument, d *mysql.SampleData) ([]string, error) {
 	req := &SamplePatchRequest{}
-	if err := render.Bind(r, req); err != nil {
-		h.Log.Info(err.Error())
-		errorJSONResponse(w, http.StatusBadRequest, "cannot apply patch")
-		return
+	fields, err := doc.decode(req)
+	if err != nil {
+		return nil, patchError(err)
 	}
+	if err := validateStruct(req); err != nil {
+		return nil, err
+	}
+	d.Foo = req.Foo
+	d.IntVal = req.IntVal
+
+	return fields, nil
+}
+
+// SamplePatchHandler updates a record partially. The format of the body is chosen by Content-Type:
+// application/json only sets the non-zero fields, application/merge-patch+json (RFC 7396)
+// and application/json-patch+json (RFC 6902) can also reset fields to the zero value.
+func (h *Handler) SamplePatchHandler(w http.ResponseWriter, r *http.Request) {
+	h.logger(r.Context()).Debug("SamplePatchHandler")
+	ctx := r.Context()
 
-	sampleId := chi.URLParam(r, "sampleId")
-	if sampleId == "" {
-		errorJSONResponse(w, http.StatusBadRequest, "Not Found")
+	id, ok := pathInt64(r, "sampleId")
+	if !ok {
+		h.problemResponse(w, r, errMissingSampleID)
 		return
 	}
 
-	id, _ := strconv.ParseInt(sampleId, 10, 64)
-	d := &mysql.SampleData{
-		Foo:    req.Foo,
-		IntVal: req.IntVal,
+	// optimistic concurrency control, the update is applied only to the version the client has
+	version, ok := ifMatchVersion(r)
+	if !ok {
+		h.problemResponse(w, r, errIfMatch)
+		return
 	}
 
 	sc := mysql.NewSample(h.Mysql)
-	rowsAffected, err := sc.UpdateSample(id, d)
+	d := &mysql.SampleData{}
+	var fields []string
+	// implicitVersion is true when the version is not from If-Match but from the current record,
+	// then a conflict is 409 rather than 412
+	implicitVersion := false
+
+	switch requestMediaType(r) {
+	case contentTypeMergePatch:
+		doc, err := newPatchDocument(d, sampleWritableMembers)
+		if err == nil {
+			err = doc.applyMergePatch(r.Body)
+		}
+		if err != nil {
+			h.problemResponse(w, r, patchError(err))
+			return
+		}
+		if fields, err = decodeSamplePatch(doc, d); err != nil {
+			h.problemResponse(w, r, err)
+			return
+		}
+	case contentTypeJSONPatch:
+		// test operations are evaluated against the current record,
+		// so the update is applied only if the record is still at the same version
+		current, err := sc.GetSample(ctx, id)
+		if err != nil {
+			h.problemResponse(w, r, err)
+			return
+		}
+		if version != 0 && version != current.Version {
+			h.problemResponse(w, r, mysql.ErrVersionConflict)
+			return
+		}
+		if version == 0 {
+			implicitVersion = true
+		}
+
+		doc, err := newPatchDocument(current, sampleWritableMembers)
+		if err == nil {
+			err = doc.applyJSONPatch(r.Body)
+		}
+		if err != nil {
+			h.problemResponse(w, r, patchError(err))
+			return
+		}
+		if fields, err = decodeSamplePatch(doc, d); err != nil {
+			h.problemResponse(w, r, err)
+			return
+		}
+		version = current.Version
+	default:
+		req := &SamplePatchRequest{}
+		if err := bindRequest(r, req); err != nil {
+			h.problemResponse(w, r, bindError(err))
+			return
+		}
+		d.Foo = req.Foo
+		d.IntVal = req.IntVal
+		if req.Foo != "" {
+			fields = append(fields, "foo")
+		}
+		if req.IntVal != 0 {
+			fields = append(fields, "int_val")
+		}
+	}
+	d.Version = version
+
+	updated, err := sc.PatchSample(ctx, id, d, fields)
+	if errors.Is(err, mysql.ErrVersionConflict) && implicitVersion {
+		h.problemResponse(w, r, newError(http.StatusConflict, CodeVersionConflict, "the resource was modified while the patch was applied", err))
+		return
+	}
 	if err != nil {
-		h.Log.Info(err.Error())
-		errorJSONResponse(w, http.StatusBadRequest, "failed patch request")
+		h.problemResponse(w, r, err)
 		return
 	}
-	h.Log.Debug(rowsAffected, " rows affected")
-
-	h.Wg.Add(1)
-	go func() {
-		defer h.Wg.Done()
 
+	h.goSafe(r.Context(), func() {
 		// purge cache
-		endpoints := []string{
-			"/sample",
-			"/sample/",
-			r.URL.Path,
+		h.purgeCacheTags(detachContext(r.Context()), sampleTag(id), sampleListTag)
+	})
+
+	if preferMinimal(r) {
+		// the entity tag of the representation which the client would get
+		if cs := acceptableCodecs(r); len(cs) > 0 {
+			w.Header().Set("ETag", versionETag(updated.Version, cs[0]))
 		}
-		h.purgeCache(context.Background(), endpoints)
-	}()
+		w.Header().Set("Preference-Applied", "return=minimal")
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	h.versionedResponse(w, r, http.StatusOK, updated, updated.Version, time.Time{})
+}
 
-	type Res struct {
-		Message string `json:"message"`
+type SamplePutRequest struct {
+	Foo    string `json:"foo" xml:"foo" validate:"required,maxlen=255"`
+	IntVal int64  `json:"int_val" xml:"int_val" validate:"min=-2147483648,max=2147483647"`
+}
+
+func (spr *SamplePutRequest) Bind(r *http.Request) error {
+	return nil
+}
+
+func (h *Handler) SamplePutHandler(w http.ResponseWriter, r *http.Request) {
+	h.logger(r.Context()).Debug("SamplePutHandler")
+	ctx := r.Context()
+
+	req := &SamplePutRequest{}
+	if err := bindRequest(r, req); err != nil {
+		h.problemResponse(w, r, bindError(err))
+		return
 	}
-	res := &Res{Message: fmt.Sprintf("%d rows affected", rowsAffected)}
-	successJSONResponse(w, res)
+
+	id, ok := pathInt64(r, "sampleId")
+	if !ok {
+		h.problemResponse(w, r, errMissingSampleID)
+		return
+	}
+
+	// optimistic concurrency control, the record is replaced only at the version the client has
+	version, ok := ifMatchVersion(r)
+	if !ok {
+		h.problemResponse(w, r, errIfMatch)
+		return
+	}
+
+	sc := mysql.NewSample(h.Mysql)
+	d, err := sc.PutSample(ctx, id, &mysql.SampleData{
+		Foo:     req.Foo,
+		IntVal:  req.IntVal,
+		Version: version,
+	})
+	if err != nil {
+		h.problemResponse(w, r, err)
+		return
+	}
+
+	h.goSafe(r.Context(), func() {
+		// purge cache
+		h.purgeCacheTags(detachContext(r.Context()), sampleTag(id), sampleListTag)
+	})
+
+	h.versionedResponse(w, r, http.StatusOK, d, d.Version, time.Time{})
 }
 
-func (h *Handler) setCache(ctx context.Context, endpoint string, data interface{}) {
+func (h *Handler) SampleDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	h.logger(r.Context()).Debug("SampleDeleteHandler")
+	ctx := r.Context()
+
+	id, ok := pathInt64(r, "sampleId")
+	if !ok {
+		h.problemResponse(w, r, errMissingSampleID)
+		return
+	}
+
+	sc := mysql.NewSample(h.Mysql)
+	rowsAffected, err := sc.DeleteSample(ctx, id)
+	if err != nil {
+		h.problemResponse(w, r, err)
+		return
+	}
+	if rowsAffected == 0 {
+		h.problemResponse(w, r, mysql.ErrNotFound)
+		return
+	}
+
+	h.goSafe(r.Context(), func() {
+		// purge cache
+		h.purgeCacheTags(detachContext(r.Context()), sampleTag(id), sampleListTag)
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) setCache(ctx context.Context, endpoint string, data interface{}, ttl time.Duration, tags []string) {
 	// write the data into Redis
 	d, err := json.Marshal(data)
 	if err != nil {
-		h.Log.Error(err.Error())
+		h.logger(ctx).Error(err.Error())
 	} else {
-		if err := myRedis.SetCache(context.Background(), h.Redis, endpoint, string(d)); err != nil {
-			h.Log.Error(err.Error())
+		if err := myRedis.SetCacheWithTags(ctx, h.Redis, endpoint, string(d), ttl, tags); err != nil {
+			h.logger(ctx).Error(err.Error())
+		}
+		h.setLocalCache(endpoint, string(d))
+	}
+}
+
+// getCache returns the cache from the in-process tier first, then from Redis.
+// A value found in Redis is copied into the in-process tier.
+func (h *Handler) getCache(ctx context.Context, endpoint string) (string, error) {
+	if h.LocalCache != nil {
+		if val, ok := h.LocalCache.Get(endpoint); ok {
+			return val, nil
 		}
 	}
+
+	val, err := myRedis.GetCache(ctx, h.Redis, endpoint)
+	if err != nil {
+		return "", err
+	}
+	h.setLocalCache(endpoint, val)
+
+	return val, nil
+}
+
+func (h *Handler) setLocalCache(endpoint string, val string) {
+	if h.LocalCache == nil {
+		return
+	}
+	ttl := h.LocalCacheTTL
+	if ttl == 0 {
+		ttl = defaultLocalCacheTTL
+	}
+	h.LocalCache.Set(endpoint, val, ttl)
 }
 
-func (h *Handler) purgeCache(ctx context.Context, endpoints []string) {
-	for _, e := range endpoints {
-		if err := myRedis.DelCache(context.Background(), h.Redis, e); err != nil {
-			h.Log.Error(err.Error())
+// purgeCacheTags deletes every cache tagged with one of tags.
+// The other instances are told to purge their in-process tier as well.
+// It runs after the response, so ctx has to be detached, see detachContext.
+func (h *Handler) purgeCacheTags(ctx context.Context, tags ...string) {
+	ctx, span := startLinkedSpan(ctx, "purgeCacheTags", attribute.StringSlice("cache.tags", tags))
+	defer span.End()
+
+	paths, err := myRedis.PurgeTags(ctx, h.Redis, tags...)
+	if err != nil {
+		h.logger(ctx).Error(err.Error())
+		return
+	}
+
+	if h.LocalCache != nil {
+		for _, p := range paths {
+			h.LocalCache.Delete(p)
 		}
 	}
+	if err := myRedis.PublishPurge(ctx, h.Redis, paths); err != nil {
+		h.logger(ctx).Error(err.Error())
+	}
+}
+
+// SubscribeCachePurge keeps the in-process cache tier in sync with the purges of the other instances
+// until ctx is canceled. It's a no-op when LocalCache is not configured.
+func (h *Handler) SubscribeCachePurge(ctx context.Context) error {
+	if h.LocalCache == nil {
+		return nil
+	}
+
+	pubsub, err := myRedis.SubscribePurge(ctx, h.Redis)
+	if err != nil {
+		return err
+	}
+
+	h.goSafe(ctx, func() {
+		defer pubsub.Close()
+
+		ch := pubsub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-ch:
+				if !ok {
+					return
+				}
+				for _, p := range strings.Split(msg.Payload, "\n") {
+					h.LocalCache.Delete(p)
+				}
+			}
+		}
+	})
+
+	return nil
 }
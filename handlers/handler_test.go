@@ -0,0 +1,105 @@
+package handler_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/sunao-uehara/go-restapi-sample/testutils"
+)
+
+func TestSampleHandlers(t *testing.T) {
+	s := newTestServer(t, "sample")
+
+	notFound := func(instance string) string {
+		return `{"type":"urn:problem-type:not_found","title":"Not Found","status":404,
+			"detail":"the resource doesn't exist","instance":"` + instance + `","code":"not_found"}`
+	}
+	testCases := []handlerTestCase{
+		{
+			Scenario: "create",
+			Method:   http.MethodPost,
+			In:       testutils.HandlerInput{Endpoint: "/sample", RequestBody: `{"foo":"a","int_val":1}`},
+			Out: testutils.HandlerOutput{
+				ResponseStatusCode: http.StatusCreated,
+				ResponseBody:       `{"id":1,"foo":"a","int_val":1,"version":1}`,
+			},
+			Partial:  true,
+			Location: "/sample/1",
+		},
+		{
+			Scenario: "put",
+			Method:   http.MethodPut,
+			In:       testutils.HandlerInput{Endpoint: "/sample/1", RequestBody: `{"foo":"b","int_val":2}`},
+			Header:   map[string]string{"If-Match": `"1-json"`},
+			Out: testutils.HandlerOutput{
+				ResponseStatusCode: http.StatusOK,
+				ResponseBody:       `{"id":1,"foo":"b","int_val":2,"version":2}`,
+			},
+			Partial: true,
+			ETag:    `"2-json"`,
+		},
+		{
+			Scenario: "get after put",
+			Method:   http.MethodGet,
+			In:       testutils.HandlerInput{Endpoint: "/sample/1"},
+			Out: testutils.HandlerOutput{
+				ResponseStatusCode: http.StatusOK,
+				ResponseBody:       `{"id":1,"foo":"b","int_val":2,"version":2}`,
+			},
+			Partial: true,
+			ETag:    `"2-json"`,
+		},
+		{
+			Scenario: "failure case, put at a stale version",
+			Method:   http.MethodPut,
+			In:       testutils.HandlerInput{Endpoint: "/sample/1", RequestBody: `{"foo":"c","int_val":3}`},
+			Header:   map[string]string{"If-Match": `"1-json"`},
+			Out:      testutils.HandlerOutput{ResponseStatusCode: http.StatusPreconditionFailed},
+		},
+		{
+			Scenario: "failure case, put without foo",
+			Method:   http.MethodPut,
+			In:       testutils.HandlerInput{Endpoint: "/sample/1", RequestBody: `{"int_val":3}`},
+			Out:      testutils.HandlerOutput{ResponseStatusCode: http.StatusBadRequest},
+		},
+		{
+			Scenario: "failure case, put a missing sample",
+			Method:   http.MethodPut,
+			In:       testutils.HandlerInput{Endpoint: "/sample/2", RequestBody: `{"foo":"c","int_val":3}`},
+			Out:      testutils.HandlerOutput{ResponseStatusCode: http.StatusNotFound, ResponseBody: notFound("/sample/2")},
+		},
+		{
+			Scenario: "failure case, patch a missing sample",
+			Method:   http.MethodPatch,
+			In:       testutils.HandlerInput{Endpoint: "/sample/2", RequestBody: `{"foo":"c"}`},
+			Out:      testutils.HandlerOutput{ResponseStatusCode: http.StatusNotFound, ResponseBody: notFound("/sample/2")},
+		},
+		{
+			Scenario: "failure case, merge patch a missing sample",
+			Method:   http.MethodPatch,
+			In:       testutils.HandlerInput{Endpoint: "/sample/2", RequestBody: `{"foo":"c"}`},
+			Header:   map[string]string{"Content-Type": "application/merge-patch+json"},
+			Out:      testutils.HandlerOutput{ResponseStatusCode: http.StatusNotFound, ResponseBody: notFound("/sample/2")},
+		},
+		{
+			Scenario: "delete",
+			Method:   http.MethodDelete,
+			In:       testutils.HandlerInput{Endpoint: "/sample/1"},
+			Out:      testutils.HandlerOutput{ResponseStatusCode: http.StatusNoContent},
+		},
+		{
+			Scenario: "failure case, get after delete",
+			Method:   http.MethodGet,
+			In:       testutils.HandlerInput{Endpoint: "/sample/1"},
+			Out:      testutils.HandlerOutput{ResponseStatusCode: http.StatusNotFound, ResponseBody: notFound("/sample/1")},
+		},
+		{
+			Scenario: "failure case, delete a missing sample",
+			Method:   http.MethodDelete,
+			In:       testutils.HandlerInput{Endpoint: "/sample/1"},
+			Out:      testutils.HandlerOutput{ResponseStatusCode: http.StatusNotFound, ResponseBody: notFound("/sample/1")},
+		},
+	}
+
+	s.run(t, testCases)
+}
@@ -1,11 +1,13 @@
 package handler
 
 import (
-	"encoding/json"
-	"log"
+	"fmt"
 	"net/http"
 	"reflect"
 	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
 )
 
 func successResponse(w http.ResponseWriter, res interface{}) {
@@ -24,40 +26,158 @@ func successResponse(w http.ResponseWriter, res interface{}) {
 	w.Write([]byte(resStr))
 }
 
-func errorResponse(w http.ResponseWriter, code int, msg string) {
-	w.WriteHeader(code)
-	w.Write([]byte(msg))
-}
+// notModified evaluates the conditional headers of the GET/HEAD request against the validators in header.
+// If-None-Match takes precedence over If-Modified-Since as RFC 7232 says.
+func notModified(r *http.Request, header http.Header) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		etag := header.Get("ETag")
+		return etag != "" && etagListMatches(inm, etag, true)
+	}
 
-// successJSONResponse respond success http status(200) with given data in json
-func successJSONResponse(w http.ResponseWriter, data interface{}) {
-	jsonString, err := json.Marshal(data)
+	ims, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
 	if err != nil {
-		log.Printf("cannot convert struct %v to json", data)
-		errorJSONResponse(w, 500, "Unknown Error Occurred")
-		return
+		return false
+	}
+	lastModified, err := http.ParseTime(header.Get("Last-Modified"))
+	if err != nil {
+		return false
 	}
+	return !lastModified.After(ims)
+}
 
-	// log.Println(string(jsonString))
-	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
-	w.WriteHeader(200)
-	w.Write([]byte(jsonString))
+// versionETag formats the version of a resource as the strong entity tag of its representation
+// in the media type of c, e.g. "3-json", since the representations in the other media types are other bytes
+func versionETag(version int64, c *codec) string {
+	return fmt.Sprintf(`"%d-%s"`, version, c.subtype())
+}
+
+// errIfMatch is the error when If-Match can't match any version
+var errIfMatch = newError(http.StatusPreconditionFailed, CodePreconditionFailed, "If-Match must be a single strong ETag or *", nil)
+
+// ifMatchVersion returns the version required by If-Match of r, zero when there is no
+// requirement on the version, i.e. If-Match is absent or "*".
+// ok is false when If-Match can't match any version.
+func ifMatchVersion(r *http.Request) (version int64, ok bool) {
+	im := strings.TrimSpace(r.Header.Get("If-Match"))
+	if im == "" || im == "*" {
+		return 0, true
+	}
+
+	// only a single strong entity tag can be checked atomically
+	if strings.Contains(im, ",") || strings.HasPrefix(im, "W/") {
+		return 0, false
+	}
+	// the entity tag of any representation matches, only the version is compared
+	tag := strings.Trim(im, `"`)
+	i := strings.LastIndexByte(tag, '-')
+	if i < 0 || !knownSubtype(tag[i+1:]) {
+		return 0, false
+	}
+	version, err := strconv.ParseInt(tag[:i], 10, 64)
+	if err != nil || version < 1 {
+		return 0, false
+	}
+	return version, true
+}
+
+// knownSubtype reports whether a codec has the subtype, see versionETag
+func knownSubtype(subtype string) bool {
+	for _, c := range codecs {
+		if c.subtype() == subtype {
+			return true
+		}
+	}
+	return false
+}
+
+// etagListMatches reports whether etag is in the comma separated list of entity tags.
+// The weak comparison ignores the W/ prefix.
+func etagListMatches(list string, etag string, weak bool) bool {
+	for _, t := range strings.Split(list, ",") {
+		t = strings.TrimSpace(t)
+		if t == "*" {
+			return true
+		}
+		if weak {
+			t = strings.TrimPrefix(t, "W/")
+			etag = strings.TrimPrefix(etag, "W/")
+		} else if strings.HasPrefix(t, "W/") || strings.HasPrefix(etag, "W/") {
+			continue
+		}
+		if t == etag {
+			return true
+		}
+	}
+	return false
 }
 
-// errorJSONResponse respond given failure/error http status(4xx~5xx) with message in json
-func errorJSONResponse(w http.ResponseWriter, code int, msg string) {
-	jsonString, _ := json.Marshal(DefaultResponseBody(msg))
+// preferMinimal reports whether the client asked for no response body with Prefer: return=minimal (RFC 7240)
+func preferMinimal(r *http.Request) bool {
+	for _, header := range r.Header.Values("Prefer") {
+		for _, pref := range strings.Split(header, ",") {
+			// the parameters of the preference don't matter
+			token := strings.SplitN(pref, ";", 2)[0]
+			kv := strings.SplitN(token, "=", 2)
+			if len(kv) == 2 && strings.EqualFold(strings.TrimSpace(kv[0]), "return") &&
+				strings.EqualFold(strings.Trim(strings.TrimSpace(kv[1]), `"`), "minimal") {
+				return true
+			}
+		}
+	}
+
+	return false
+}
 
-	// log.Println(string(jsonString))
-	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
-	w.WriteHeader(code)
-	w.Write([]byte(jsonString))
+// responseGuard is a http.ResponseWriter which keeps the first response of a handler.
+// A handler which forgets to return after responding an error writes a second response,
+// it's logged and dropped instead of being appended to the first one.
+type responseGuard struct {
+	http.ResponseWriter
+	r      *http.Request
+	log    *zap.SugaredLogger
+	status int
+	// discarding is true after the second WriteHeader, the body of the second response is dropped
+	discarding bool
 }
 
-func DefaultResponseBody(msg string) interface{} {
-	type Data struct {
-		Msg string `json:"message"`
+func (g *responseGuard) WriteHeader(code int) {
+	if g.status != 0 {
+		g.log.Errorf("double response write: %s %s responded %d, then %d", g.r.Method, g.r.URL.RequestURI(), g.status, code)
+		g.discarding = true
+		return
 	}
+	g.status = code
+	g.ResponseWriter.WriteHeader(code)
+}
+
+func (g *responseGuard) Write(b []byte) (int, error) {
+	if g.discarding {
+		return len(b), nil
+	}
+	if g.status == 0 {
+		g.status = http.StatusOK
+	}
+	return g.ResponseWriter.Write(b)
+}
+
+func (g *responseGuard) Flush() {
+	if f, ok := g.ResponseWriter.(http.Flusher); ok && !g.discarding {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the original http.ResponseWriter for http.ResponseController
+func (g *responseGuard) Unwrap() http.ResponseWriter {
+	return g.ResponseWriter
+}
 
-	return Data{Msg: msg}
+// GuardMiddleware wraps the http.ResponseWriter with responseGuard, so that a double write is logged
+func (h *Handler) GuardMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(&responseGuard{ResponseWriter: w, r: r, log: h.logger(r.Context())}, r)
+	})
 }
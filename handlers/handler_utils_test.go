@@ -0,0 +1,140 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestIfMatchVersion(t *testing.T) {
+	type testCase struct {
+		Scenario string
+		IfMatch  string
+		Version  int64
+		OK       bool
+	}
+	testCases := []testCase{
+		{"no header", "", 0, true},
+		{"any version", "*", 0, true},
+		{"strong etag", `"3-json"`, 3, true},
+		{"etag of another representation", `"3-msgpack"`, 3, true},
+		{"etag without the media type", `"3"`, 0, false},
+		{"etag of an unknown media type", `"3-png"`, 0, false},
+		{"weak etag can't be used", `W/"3-json"`, 0, false},
+		{"list of etags can't be checked atomically", `"3-json", "4-json"`, 0, false},
+		{"invalid etag", `"abc"`, 0, false},
+	}
+
+	for _, tc := range testCases {
+		r := httptest.NewRequest(http.MethodPatch, "/sample/1", nil)
+		if tc.IfMatch != "" {
+			r.Header.Set("If-Match", tc.IfMatch)
+		}
+		version, ok := ifMatchVersion(r)
+		if version != tc.Version || ok != tc.OK {
+			t.Errorf("%s: test failed, got: %v, %v, want: %v, %v", tc.Scenario, version, ok, tc.Version, tc.OK)
+		}
+	}
+}
+
+func TestNotModified(t *testing.T) {
+	header := http.Header{}
+	header.Set("ETag", `"3"`)
+	header.Set("Last-Modified", "Mon, 01 Nov 2021 10:00:00 GMT")
+
+	type testCase struct {
+		Scenario string
+		Header   map[string]string
+		Expected bool
+	}
+	testCases := []testCase{
+		{"no condition", map[string]string{}, false},
+		{"same etag", map[string]string{"If-None-Match": `"2", W/"3"`}, true},
+		{"another etag wins over the date", map[string]string{
+			"If-None-Match":     `"2"`,
+			"If-Modified-Since": "Mon, 01 Nov 2021 10:00:00 GMT",
+		}, false},
+		{"same date", map[string]string{"If-Modified-Since": "Mon, 01 Nov 2021 10:00:00 GMT"}, true},
+		{"older date", map[string]string{"If-Modified-Since": "Mon, 01 Nov 2021 09:59:59 GMT"}, false},
+	}
+
+	for _, tc := range testCases {
+		r := httptest.NewRequest(http.MethodGet, "/sample/1", nil)
+		for k, v := range tc.Header {
+			r.Header.Set(k, v)
+		}
+		if got := notModified(r, header); got != tc.Expected {
+			t.Errorf("%s: test failed, got: %v, want: %v", tc.Scenario, got, tc.Expected)
+		}
+	}
+}
+
+func TestPreferMinimal(t *testing.T) {
+	type testCase struct {
+		Scenario string
+		Prefer   []string
+		Expected bool
+	}
+	testCases := []testCase{
+		{"no header", nil, false},
+		{"minimal", []string{"return=minimal"}, true},
+		{"representation", []string{"return=representation"}, false},
+		{"one of the preferences", []string{"respond-async, return=minimal; foo=bar"}, true},
+		{"one of the headers", []string{"wait=10", "return=minimal"}, true},
+		{"quoted value", []string{`return = "minimal"`}, true},
+	}
+
+	for _, tc := range testCases {
+		r := httptest.NewRequest(http.MethodPatch, "/sample/1", nil)
+		for _, v := range tc.Prefer {
+			r.Header.Add("Prefer", v)
+		}
+		if got := preferMinimal(r); got != tc.Expected {
+			t.Errorf("%s: test failed, got: %v, want: %v", tc.Scenario, got, tc.Expected)
+		}
+	}
+}
+
+func TestGuardMiddleware(t *testing.T) {
+	core, logs := observer.New(zap.ErrorLevel)
+	h := NewHandler(&HandlerOptions{Log: zap.New(core).Sugar()})
+
+	type testCase struct {
+		Scenario string
+		Handler  http.HandlerFunc
+		Status   int
+		Body     string
+		Logged   int
+	}
+	testCases := []testCase{
+		{"single response", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte("a"))
+			w.Write([]byte("b"))
+		}, http.StatusCreated, "ab", 0},
+		{"missing return after an error", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("error"))
+			successResponse(w, "ok")
+		}, http.StatusInternalServerError, "error", 1},
+		{"header after the body", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("ok"))
+			w.WriteHeader(http.StatusNotFound)
+		}, http.StatusOK, "ok", 1},
+	}
+
+	for _, tc := range testCases {
+		logs.TakeAll()
+		rec := httptest.NewRecorder()
+		h.GuardMiddleware(tc.Handler).ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/sample", nil))
+		if rec.Code != tc.Status || rec.Body.String() != tc.Body {
+			t.Errorf("%s: test failed, got: %v %q, want: %v %q", tc.Scenario, rec.Code, rec.Body.String(), tc.Status, tc.Body)
+		}
+		if n := logs.Len(); n != tc.Logged {
+			t.Errorf("%s: test failed, got: %v logs, want: %v", tc.Scenario, n, tc.Logged)
+		}
+	}
+}
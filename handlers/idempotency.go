@@ -0,0 +1,165 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"path"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+
+	myRedis "github.com/sunao-uehara/go-restapi-sample/storages/redis"
+)
+
+const (
+	idempotencyKeyHeader = "Idempotency-Key"
+	// idempotencyLockTTL is how long a key stays claimed when the instance running the request dies,
+	// it has to be longer than any request
+	idempotencyLockTTL = 1 * time.Minute
+	// maxIdempotencyKeyLength is the maximum length of Idempotency-Key
+	maxIdempotencyKeyLength = 255
+)
+
+// the codes of the problems with Idempotency-Key
+const (
+	CodeIdempotencyKeyReused  ErrorCode = "idempotency_key_reused"
+	CodeIdempotencyInProgress ErrorCode = "idempotency_in_progress"
+)
+
+// idempotentResponse is the response replayed for the retries of a request
+type idempotentResponse struct {
+	Status int         `json:"status"`
+	Header http.Header `json:"header"`
+	Body   []byte      `json:"body"`
+}
+
+// IdempotencyMiddleware makes a request with Idempotency-Key run only once.
+// The response is stored in Redis and replayed for the retries with the same key,
+// 409 is returned while the first request is still running, and 422 when the key is reused with another body.
+// 5xx responses are not stored, so that they can be retried.
+func (h *Handler) IdempotencyMiddleware(nextFunc http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		idemKey := r.Header.Get(idempotencyKeyHeader)
+		if idemKey == "" {
+			nextFunc(w, r)
+			return
+		}
+		if len(idemKey) > maxIdempotencyKeyLength {
+			h.problemResponse(w, r, invalidParameterError("Idempotency-Key is too long", nil))
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBulkBodyBytes))
+		if err != nil {
+			h.problemResponse(w, r, bindError(err))
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		// the key is scoped by the endpoint, the fingerprint tells whether it's the same request
+		key := r.Method + " " + path.Clean(r.URL.Path) + " " + idemKey
+		sum := sha256.Sum256(body)
+		fingerprint := hex.EncodeToString(sum[:])
+
+		// a random token identifying the claim of this request, see myRedis.ReleaseIdempotencyKey
+		token := newRequestID()
+		rec, acquired, err := myRedis.AcquireIdempotencyKey(ctx, h.Redis, key, fingerprint, token, idempotencyLockTTL)
+		if err != nil {
+			// running the request without the key could duplicate it
+			h.problemResponse(w, r, newError(http.StatusServiceUnavailable, statusCode(http.StatusServiceUnavailable), "cannot check Idempotency-Key", err))
+			return
+		}
+		if !acquired {
+			h.replayIdempotent(w, r, rec, fingerprint)
+			return
+		}
+
+		// the key is released unless the response is saved, also when the handler panics,
+		// so that a retry runs the request again rather than waiting for idempotencyLockTTL
+		saving := false
+		defer func() {
+			if saving {
+				return
+			}
+			releaseCtx, cancel := afterRequestContext(r)
+			defer cancel()
+			if err := myRedis.ReleaseIdempotencyKey(releaseCtx, h.Redis, key, fingerprint, token); err != nil {
+				h.logger(r.Context()).Warn(err.Error())
+			}
+		}()
+
+		res := newResponseRecorder()
+		nextFunc(res, r)
+		if res.status == 0 {
+			res.status = http.StatusOK
+		}
+
+		if res.status < http.StatusInternalServerError {
+			saving = true
+			saveCtx, cancel := afterRequestContext(r)
+			defer cancel()
+
+			header := res.Header().Clone()
+			header.Del(cacheTagHeader)
+			header.Del("Set-Cookie")
+			val, err := json.Marshal(&idempotentResponse{Status: res.status, Header: header, Body: res.body.Bytes()})
+			if err == nil {
+				err = myRedis.SaveIdempotencyKey(saveCtx, h.Redis, key, fingerprint, token, val, h.idempotencyTTL())
+			}
+			if err != nil {
+				h.logger(r.Context()).Warn(err.Error())
+			}
+		}
+
+		for k, values := range res.Header() {
+			w.Header()[k] = values
+		}
+		w.WriteHeader(res.status)
+		w.Write(res.body.Bytes())
+	}
+}
+
+// afterRequestContext returns the context to save or release the key after the handler. The client may be gone,
+// but it has to be done anyway. It's still a part of the request, so the span is kept.
+func afterRequestContext(r *http.Request) (context.Context, context.CancelFunc) {
+	ctx := trace.ContextWithSpan(detachContext(r.Context()), trace.SpanFromContext(r.Context()))
+	return context.WithTimeout(ctx, 5*time.Second)
+}
+
+// replayIdempotent responds to a retry of a request which has already been run or is still running
+func (h *Handler) replayIdempotent(w http.ResponseWriter, r *http.Request, rec *myRedis.IdempotencyRecord, fingerprint string) {
+	if rec.Fingerprint != fingerprint {
+		h.problemResponse(w, r, newError(http.StatusUnprocessableEntity, CodeIdempotencyKeyReused, "Idempotency-Key was used for another request", nil))
+		return
+	}
+	if !rec.Done {
+		h.problemResponse(w, r, newError(http.StatusConflict, CodeIdempotencyInProgress, "the request with the same Idempotency-Key is in progress", nil))
+		return
+	}
+
+	res := &idempotentResponse{}
+	if err := json.Unmarshal(rec.Response, res); err != nil {
+		h.problemResponse(w, r, internalError(err))
+		return
+	}
+	for k, values := range res.Header {
+		w.Header()[k] = values
+	}
+	w.Header().Set("Idempotent-Replayed", "true")
+	w.WriteHeader(res.Status)
+	w.Write(res.Body)
+}
+
+func (h *Handler) idempotencyTTL() time.Duration {
+	if h.IdempotencyTTL == 0 {
+		return myRedis.DefaultIdempotencyTTL
+	}
+	return h.IdempotencyTTL
+}
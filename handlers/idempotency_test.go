@@ -0,0 +1,164 @@
+package handler
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	myRedis "github.com/sunao-uehara/go-restapi-sample/storages/redis"
+)
+
+func TestIdempotencyMiddleware(t *testing.T) {
+	h, _ := newTestHandler(t)
+
+	calls := 0
+	status := http.StatusOK
+	next := func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Location", "/sample/1")
+		w.WriteHeader(status)
+		w.Write([]byte(`{"id":1}`))
+	}
+	handler := h.IdempotencyMiddleware(next)
+
+	type out struct {
+		Status int
+		Calls  int
+	}
+	type testCase struct {
+		Scenario string
+		Key      string
+		Body     string
+		Status   int
+		Expected out
+	}
+	testCases := []testCase{
+		{"without key", "", `{"foo":"a"}`, http.StatusOK, out{http.StatusOK, 1}},
+		{"first request", "k1", `{"foo":"a"}`, http.StatusOK, out{http.StatusOK, 2}},
+		{"retry is replayed", "k1", `{"foo":"a"}`, http.StatusOK, out{http.StatusOK, 2}},
+		{"another body", "k1", `{"foo":"b"}`, http.StatusOK, out{http.StatusUnprocessableEntity, 2}},
+		{"server error", "k2", `{"foo":"a"}`, http.StatusInternalServerError, out{http.StatusInternalServerError, 3}},
+		{"retry after server error runs again", "k2", `{"foo":"a"}`, http.StatusOK, out{http.StatusOK, 4}},
+	}
+
+	for _, tc := range testCases {
+		status = tc.Status
+		r := httptest.NewRequest(http.MethodPost, "/sample", strings.NewReader(tc.Body))
+		if tc.Key != "" {
+			r.Header.Set(idempotencyKeyHeader, tc.Key)
+		}
+		w := httptest.NewRecorder()
+		handler(w, r)
+
+		if w.Code != tc.Expected.Status || calls != tc.Expected.Calls {
+			t.Errorf("%s: test failed, got: %v, %v, want: %v, %v", tc.Scenario, w.Code, calls, tc.Expected.Status, tc.Expected.Calls)
+		}
+		if tc.Scenario == "retry is replayed" {
+			if w.Header().Get("Idempotent-Replayed") != "true" || w.Header().Get("Location") != "/sample/1" || w.Body.String() != `{"id":1}` {
+				t.Errorf("%s: test failed, got: %v, %v", tc.Scenario, w.Header(), w.Body.String())
+			}
+		}
+	}
+
+	// the first request is still running
+	body := `{"foo":"a"}`
+	sum := sha256.Sum256([]byte(body))
+	myRedis.AcquireIdempotencyKey(context.Background(), h.Redis, "POST /sample k3", hex.EncodeToString(sum[:]), "other", time.Minute)
+	r := httptest.NewRequest(http.MethodPost, "/sample", strings.NewReader(body))
+	r.Header.Set(idempotencyKeyHeader, "k3")
+	w := httptest.NewRecorder()
+	handler(w, r)
+	if w.Code != http.StatusConflict {
+		t.Errorf("test failed, got: %v, want: %v", w.Code, http.StatusConflict)
+	}
+}
+
+func TestIdempotencyMiddlewarePanic(t *testing.T) {
+	h, _ := newTestHandler(t)
+
+	calls := 0
+	handler := h.IdempotencyMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			panic("broken")
+		}
+		w.WriteHeader(http.StatusCreated)
+	})
+
+	serve := func() (code int, rec interface{}) {
+		defer func() {
+			rec = recover()
+		}()
+		r := httptest.NewRequest(http.MethodPost, "/sample", strings.NewReader(`{"foo":"a"}`))
+		r.Header.Set(idempotencyKeyHeader, "k1")
+		w := httptest.NewRecorder()
+		handler(w, r)
+		return w.Code, nil
+	}
+
+	// the panic goes through to RecoverMiddleware, and the key is released on the way
+	if _, rec := serve(); rec == nil {
+		t.Errorf("test failed, got: no panic, want: a panic")
+	}
+	if code, _ := serve(); code != http.StatusCreated || calls != 2 {
+		t.Errorf("test failed, got: %v, %v calls, want: %v, 2 calls", code, calls, http.StatusCreated)
+	}
+}
+
+func TestReleaseIdempotencyKey(t *testing.T) {
+	h, mr := newTestHandler(t)
+	ctx := context.Background()
+
+	myRedis.AcquireIdempotencyKey(ctx, h.Redis, "POST /sample k1", "f1", "first", time.Minute)
+	// the claim of the first request has expired, and a retry has claimed the key
+	mr.FastForward(2 * time.Minute)
+	myRedis.AcquireIdempotencyKey(ctx, h.Redis, "POST /sample k1", "f1", "second", time.Minute)
+
+	if err := myRedis.ReleaseIdempotencyKey(ctx, h.Redis, "POST /sample k1", "f1", "first"); err != nil {
+		t.Fatalf("expected non error, but some error occurred, %s", err.Error())
+	}
+	if !mr.Exists("idempotency:POST /sample k1") {
+		t.Errorf("test failed, the claim of the retry is released by the first request")
+	}
+
+	myRedis.ReleaseIdempotencyKey(ctx, h.Redis, "POST /sample k1", "f1", "second")
+	if mr.Exists("idempotency:POST /sample k1") {
+		t.Errorf("test failed, the claim of the retry is not released")
+	}
+}
+
+func TestSaveIdempotencyKey(t *testing.T) {
+	h, mr := newTestHandler(t)
+	ctx := context.Background()
+
+	myRedis.AcquireIdempotencyKey(ctx, h.Redis, "POST /sample k1", "f1", "first", time.Minute)
+	// the claim of the first request has expired, and a retry has claimed the key
+	mr.FastForward(2 * time.Minute)
+	myRedis.AcquireIdempotencyKey(ctx, h.Redis, "POST /sample k1", "f1", "second", time.Minute)
+
+	err := myRedis.SaveIdempotencyKey(ctx, h.Redis, "POST /sample k1", "f1", "first", []byte(`{}`), time.Hour)
+	if !errors.Is(err, myRedis.ErrIdempotencyClaimLost) {
+		t.Errorf("test failed, got: %v, want: %v", err, myRedis.ErrIdempotencyClaimLost)
+	}
+	rec, acquired, _ := myRedis.AcquireIdempotencyKey(ctx, h.Redis, "POST /sample k1", "f1", "third", time.Minute)
+	if acquired || rec.Done || rec.Token != "second" {
+		t.Errorf("test failed, the claim of the retry is overwritten by the first request")
+	}
+
+	if err := myRedis.SaveIdempotencyKey(ctx, h.Redis, "POST /sample k1", "f1", "second", []byte(`{}`), time.Hour); err != nil {
+		t.Fatalf("expected non error, but some error occurred, %s", err.Error())
+	}
+	rec, _, _ = myRedis.AcquireIdempotencyKey(ctx, h.Redis, "POST /sample k1", "f1", "third", time.Minute)
+	if rec == nil || !rec.Done {
+		t.Errorf("test failed, got: %v, want a saved response", rec)
+	}
+	if ttl := mr.TTL("idempotency:POST /sample k1"); ttl != time.Hour {
+		t.Errorf("test failed, got: %v, want: %v", ttl, time.Hour)
+	}
+}
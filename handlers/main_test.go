@@ -0,0 +1,159 @@
+package handler_test
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	_ "github.com/go-sql-driver/mysql"
+	"go.uber.org/zap"
+
+	handler "github.com/sunao-uehara/go-restapi-sample/handlers"
+	"github.com/sunao-uehara/go-restapi-sample/router"
+	mysql "github.com/sunao-uehara/go-restapi-sample/storages/mysql"
+	"github.com/sunao-uehara/go-restapi-sample/testutils"
+)
+
+// the handler tests have their own database, since the packages are tested in parallel
+// and the storage tests reset the tables of theirs
+const (
+	testServerSource = "root:@tcp(127.0.0.1:3306)/?timeout=1s"
+	testDBName       = "go-restapi-sample_handlers_test"
+	testDBSource     = "root:@tcp(127.0.0.1:3306)/" + testDBName + "?parseTime=true&timeout=1s"
+)
+
+// testServer serves the routes of router.NewRouter with the test database and miniredis
+type testServer struct {
+	h      *handler.Handler
+	router http.Handler
+}
+
+// newTestServer migrates the test database and empties tables. The test is skipped when MySQL is not running,
+// see launch_db.sh
+func newTestServer(t *testing.T, tables ...string) *testServer {
+	server, err := sql.Open("mysql", testServerSource)
+	if err != nil {
+		t.Fatalf("cannot connect to db: %s", err)
+	}
+	defer server.Close()
+	if err := server.Ping(); err != nil {
+		t.Skipf("MySQL is not available: %s", err)
+	}
+	if _, err := server.Exec("CREATE DATABASE IF NOT EXISTS `" + testDBName + "`"); err != nil {
+		t.Fatalf("cannot create the test database: %s", err)
+	}
+
+	db, err := sql.Open("mysql", testDBSource)
+	if err != nil {
+		t.Fatalf("cannot connect to db: %s", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	m, err := mysql.NewMigrator(db)
+	if err != nil {
+		t.Fatalf("cannot load the migrations: %s", err)
+	}
+	if err := m.Up(context.Background()); err != nil {
+		t.Fatalf("cannot migrate the test database: %s", err)
+	}
+	for _, table := range tables {
+		if _, err := db.Exec("TRUNCATE TABLE " + table); err != nil {
+			t.Fatalf("cannot empty %s: %s", table, err)
+		}
+	}
+
+	mr := miniredis.RunT(t)
+	h := handler.NewHandler(&handler.HandlerOptions{
+		Wg:    &sync.WaitGroup{},
+		Mysql: db,
+		Redis: redis.NewClient(&redis.Options{Addr: mr.Addr()}),
+		Log:   zap.NewNop().Sugar(),
+	})
+
+	return &testServer{h: h, router: router.NewRouter(h)}
+}
+
+// do serves the request, and waits for the work after the response, e.g. the cache purge,
+// so that the next request sees it
+func (s *testServer) do(method string, endpoint string, body string, header map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, endpoint, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, req)
+	s.h.Wg.Wait()
+
+	return rec
+}
+
+// handlerTestCase is a request and its expected response, Body is compared as JSON when it's not empty.
+// With Partial only the members of Out.ResponseBody are compared, e.g. to leave out the timestamps.
+type handlerTestCase struct {
+	Scenario string
+	Method   string
+	In       testutils.HandlerInput
+	Header   map[string]string
+	Out      testutils.HandlerOutput
+	Partial  bool
+	Location string
+	ETag     string
+}
+
+// run serves the cases in order, each one sees the changes of the previous ones
+func (s *testServer) run(t *testing.T, testCases []handlerTestCase) {
+	for _, tc := range testCases {
+		rec := s.do(tc.Method, tc.In.Endpoint, tc.In.RequestBody, tc.Header)
+
+		if rec.Code != tc.Out.ResponseStatusCode {
+			t.Errorf("%s: test failed, got: %v, want: %v, %s", tc.Scenario, rec.Code, tc.Out.ResponseStatusCode, rec.Body.String())
+			continue
+		}
+		if got := rec.Header().Get("Location"); got != tc.Location {
+			t.Errorf("%s: test failed, got: %v, want: %v", tc.Scenario, got, tc.Location)
+		}
+		if got := rec.Header().Get("ETag"); tc.ETag != "" && got != tc.ETag {
+			t.Errorf("%s: test failed, got: %v, want: %v", tc.Scenario, got, tc.ETag)
+		}
+		if tc.Out.ResponseBody == "" {
+			continue
+		}
+		if tc.Partial {
+			if ok, err := containsJSON(rec.Body.String(), tc.Out.ResponseBody); err != nil || !ok {
+				t.Errorf("%s: test failed, got: %v, want the members of: %v", tc.Scenario, rec.Body.String(), tc.Out.ResponseBody)
+			}
+			continue
+		}
+		if ok, err := testutils.EqualJSON(rec.Body.String(), tc.Out.ResponseBody); err != nil || !ok {
+			t.Errorf("%s: test failed, got: %v, want: %v", tc.Scenario, rec.Body.String(), tc.Out.ResponseBody)
+		}
+	}
+}
+
+// containsJSON reports whether the JSON object s has every member of the JSON object sub
+func containsJSON(s string, sub string) (bool, error) {
+	var o, subo map[string]interface{}
+	if err := json.Unmarshal([]byte(s), &o); err != nil {
+		return false, err
+	}
+	if err := json.Unmarshal([]byte(sub), &subo); err != nil {
+		return false, err
+	}
+	for k, v := range subo {
+		if !reflect.DeepEqual(o[k], v) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
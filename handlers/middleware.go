@@ -1,71 +1,276 @@
 package handler
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	chi "github.com/go-chi/chi/v5"
+	"go.opentelemetry.io/otel/attribute"
 
-	mysql "github.com/sunao-uehara/go-restapi-sample/storages/mysql"
 	myRedis "github.com/sunao-uehara/go-restapi-sample/storages/redis"
 )
 
+// defaultCacheVary is the list of request headers which are a part of the cache key
+// when HandlerOptions.CacheVary is not given
+var defaultCacheVary = []string{"Accept", "Accept-Language"}
+
+// defaultCacheFreshFor is how long a cached response is served without revalidation
+// when HandlerOptions.CacheFreshFor is not given
+const defaultCacheFreshFor = 1 * time.Minute
+
+// defaultLocalCacheTTL is how long a response is kept in the in-process tier
+// when HandlerOptions.LocalCacheTTL is not given. It's short since a purge message may be lost.
+const defaultLocalCacheTTL = 10 * time.Second
+
+// cacheTagHeader is the response header through which a handler tags its response,
+// see setCacheTags. It's consumed by CacheMiddleware and never sent to the client.
+const cacheTagHeader = "Cache-Tag"
+
+// cachedResponse is what CacheMiddleware stores into Redis, it doesn't know anything about the payload
+type cachedResponse struct {
+	Status       int    `json:"status"`
+	ContentType  string `json:"content_type"`
+	LastModified string `json:"last_modified,omitempty"`
+	ETag         string `json:"etag,omitempty"`
+	Body         []byte `json:"body"`
+	// FreshUntil is unix time in milliseconds, after that the response is stale and revalidated in background
+	FreshUntil int64 `json:"fresh_until"`
+}
+
+// responseRecorder is a http.ResponseWriter which only keeps the response in memory,
+// so that it can be cached and shared by the requests waiting for the same key
+type responseRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newResponseRecorder() *responseRecorder {
+	return &responseRecorder{header: http.Header{}}
+}
+
+func (rr *responseRecorder) Header() http.Header {
+	return rr.header
+}
+
+func (rr *responseRecorder) WriteHeader(code int) {
+	if rr.status == 0 {
+		rr.status = code
+	}
+}
+
+func (rr *responseRecorder) Write(b []byte) (int, error) {
+	if rr.status == 0 {
+		rr.status = http.StatusOK
+	}
+	return rr.body.Write(b)
+}
+
+// CacheMiddleware serves GET requests from Redis and stores successful responses of nextFunc.
+// It can wrap any handler since the response is cached as raw bytes.
+// Concurrent misses of the same key run nextFunc only once, and a stale response
+// is served while a single background request refreshes it.
 func (h *Handler) CacheMiddleware(nextFunc http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
 
-		// do something before `func`
-		h.Log.Debug("before func")
+		if r.Method != http.MethodGet {
+			nextFunc(w, r)
+			return
+		}
+
 		// get the data from redis/cache first
-		endpoint := r.URL.Path
-		val, err := myRedis.GetCache(ctx, h.Redis, endpoint)
+		key := h.responseCacheKey(r)
+		val, err := h.getCache(ctx, key)
 		if err == nil && val != "" {
-			s := &mysql.SampleData{}
-			if err := json.Unmarshal([]byte(val), s); err == nil {
-				h.Log.Debugf("get sample data from redis: %s", val)
-				successJSONResponse(w, s)
+			res := &cachedResponse{}
+			if err := json.Unmarshal([]byte(val), res); err == nil {
+				h.logger(r.Context()).Debugf("get response from redis: %s", key)
+				if time.Now().UnixMilli() > res.FreshUntil {
+					h.revalidate(key, nextFunc, r)
+					w.Header().Set("X-Cache", "STALE")
+				} else {
+					w.Header().Set("X-Cache", "HIT")
+				}
+				header := http.Header{}
+				if res.ContentType != "" {
+					header.Set("Content-Type", res.ContentType)
+				}
+				if res.LastModified != "" {
+					header.Set("Last-Modified", res.LastModified)
+				}
+				if res.ETag != "" {
+					header.Set("ETag", res.ETag)
+				}
+				writeSharedResponse(w, r, header, res.Status, res.Body)
 				return
 			}
 		}
 
-		nextFunc(w, r)
+		v, _, _ := h.cacheGroup.Do(key, func() (interface{}, error) {
+			return h.loadResponse(key, nextFunc, detachRequest(r)), nil
+		})
+		rec := v.(*responseRecorder)
 
-		// do something after `func`
-		h.Log.Debug("after func")
+		w.Header().Set("X-Cache", "MISS")
+		writeSharedResponse(w, r, rec.Header(), rec.status, rec.body.Bytes())
 	}
 }
 
-func (h *Handler) StatsMiddleware(nextFunc http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		// ctx := r.Context()
-		h.Log.Debug("before func")
+// writeSharedResponse writes a response which may have been produced for another request,
+// so the conditional headers of r are evaluated here instead of in the handler
+func writeSharedResponse(w http.ResponseWriter, r *http.Request, header http.Header, status int, body []byte) {
+	for k, values := range header {
+		if k == cacheTagHeader {
+			continue
+		}
+		w.Header()[k] = values
+	}
 
-		// // do something before `func`
-		// now := time.Now()
+	if status == http.StatusOK && notModified(r, header) {
+		w.Header().Del("Content-Type")
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
 
-		nextFunc(w, r)
+	w.WriteHeader(status)
+	w.Write(body)
+}
 
-		// // do something after `func`
+// loadResponse runs nextFunc and stores the response when it's cacheable.
+// The cache is written before returning, so that the requests coming right after
+// the coalesced ones don't hit the database again.
+func (h *Handler) loadResponse(key string, nextFunc http.HandlerFunc, r *http.Request) *responseRecorder {
+	// r is detached, the response may be shared by other requests
+	ctx, span := startLinkedSpan(r.Context(), "loadResponse", attribute.String("cache.key", key))
+	defer span.End()
+	r = r.WithContext(ctx)
 
-		// elapsed := now - time.Now()
-		// endpoint := r.URL.Path
+	rec := newResponseRecorder()
+	nextFunc(rec, r)
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
 
-		// uniq_id := unique_
+	if cacheable(rec) {
+		freshFor := h.CacheFreshFor
+		if freshFor == 0 {
+			freshFor = defaultCacheFreshFor
+		}
+		ttl := h.CacheTTL
+		if ttl == 0 {
+			ttl = myRedis.DefaultCacheTTL
+		}
+
+		res := &cachedResponse{
+			Status:       rec.status,
+			ContentType:  rec.Header().Get("Content-Type"),
+			LastModified: rec.Header().Get("Last-Modified"),
+			ETag:         rec.Header().Get("ETag"),
+			Body:         rec.body.Bytes(),
+			FreshUntil:   time.Now().Add(freshFor).UnixMilli(),
+		}
+		h.setCache(r.Context(), key, res, ttl, rec.Header().Values(cacheTagHeader))
+	}
+
+	return rec
+}
+
+// revalidate refreshes the cache of key in background, at most once at a time per key
+func (h *Handler) revalidate(key string, nextFunc http.HandlerFunc, r *http.Request) {
+	h.refreshMu.Lock()
+	if h.refreshing[key] {
+		h.refreshMu.Unlock()
+		return
+	}
+	h.refreshing[key] = true
+	h.refreshMu.Unlock()
+
+	req := detachRequest(r)
+	h.goSafe(r.Context(), func() {
+		defer func() {
+			h.refreshMu.Lock()
+			delete(h.refreshing, key)
+			h.refreshMu.Unlock()
+		}()
+
+		h.logger(r.Context()).Debugf("revalidate cache: %s", key)
+		h.cacheGroup.Do(key, func() (interface{}, error) {
+			return h.loadResponse(key, nextFunc, req), nil
+		})
+	})
+}
+
+// detachRequest copies r with a context which is not canceled when the client goes away,
+// since the response is shared by other requests. The chi route context is copied
+// because chi reuses it once the original request is finished, and so are the values parsed by PathParams
+// and the request ID.
+// The conditional headers are dropped, so that the full response is always produced.
+func detachRequest(r *http.Request) *http.Request {
+	ctx := detachContext(r.Context())
+	if src := chi.RouteContext(r.Context()); src != nil {
+		rctx := chi.NewRouteContext()
+		rctx.Routes = src.Routes
+		rctx.RoutePath = src.RoutePath
+		rctx.RouteMethod = src.RouteMethod
+		rctx.RoutePatterns = append([]string(nil), src.RoutePatterns...)
+		rctx.URLParams.Keys = append([]string(nil), src.URLParams.Keys...)
+		rctx.URLParams.Values = append([]string(nil), src.URLParams.Values...)
+		ctx = context.WithValue(ctx, chi.RouteCtxKey, rctx)
+	}
+	if values := pathParams(r.Context()); values != nil {
+		ctx = withPathParams(ctx, values)
+	}
 
-		// // send it to ES.
-		// json := `
-		// 	{
-		// 		"trans_id": uniq_id
-		// 		"endpoint":  endpoint,
-		// 		"elapsed_time" : elapsed
-		// 		"container_id": XXX
-		// 		"user_id": id,
-		// 		"http_response": res.Number
-		// 		"time": current_unixtimestamp
-		// 	}
-		// `
-		// go func() {
+	req := r.Clone(ctx)
+	req.Header.Del("If-Modified-Since")
+	req.Header.Del("If-None-Match")
+	return req
+}
 
-		// }()
+// setCacheTags tags the response, so that purgeCacheTags can delete its cache
+// when the resources it contains are modified
+func setCacheTags(w http.ResponseWriter, tags ...string) {
+	for _, t := range tags {
+		w.Header().Add(cacheTagHeader, t)
+	}
+}
 
-		h.Log.Debug("after func")
+// cacheable reports whether the recorded response may be shared with other clients
+func cacheable(rec *responseRecorder) bool {
+	if rec.status != http.StatusOK {
+		return false
+	}
+	if rec.Header().Get("Set-Cookie") != "" {
+		return false
 	}
+	cc := strings.ToLower(rec.Header().Get("Cache-Control"))
+	return !strings.Contains(cc, "no-store") && !strings.Contains(cc, "private")
+}
+
+// responseCacheKey builds the cache key from the normalized path, the method,
+// the sorted query string and the values of the vary headers.
+func (h *Handler) responseCacheKey(r *http.Request) string {
+	vary := h.CacheVary
+	if vary == nil {
+		vary = defaultCacheVary
+	}
+	headers := make([]string, 0, len(vary))
+	for _, name := range vary {
+		headers = append(headers, strings.ToLower(name)+"="+r.Header.Get(name))
+	}
+	sort.Strings(headers)
+
+	return cachePathPrefix(r.URL.Path) + r.Method + "|" + r.URL.Query().Encode() + "|" + strings.Join(headers, "&")
+}
+
+// cachePathPrefix is the common prefix of every cache key of the path, "/sample" and "/sample/" share it
+func cachePathPrefix(p string) string {
+	return path.Clean("/"+p) + "|"
 }
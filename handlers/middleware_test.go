@@ -0,0 +1,250 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+
+	"github.com/sunao-uehara/go-restapi-sample/storages/lru"
+)
+
+func newTestHandler(t *testing.T) (*Handler, *miniredis.Miniredis) {
+	mr := miniredis.RunT(t)
+	h := NewHandler(&HandlerOptions{
+		Log:   zap.NewNop().Sugar(),
+		Wg:    &sync.WaitGroup{},
+		Redis: redis.NewClient(&redis.Options{Addr: mr.Addr()}),
+	})
+	return h, mr
+}
+
+func TestCacheMiddleware(t *testing.T) {
+	h, _ := newTestHandler(t)
+
+	calls := 0
+	next := func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		setCacheTags(w, sampleListTag)
+		w.Header().Set("Content-Type", "text/csv")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("id,foo\n1,var\n"))
+	}
+	handler := h.CacheMiddleware(next)
+
+	type testCase struct {
+		Scenario string
+		Endpoint string
+		Calls    int
+		XCache   string
+	}
+	testCases := []testCase{
+		{"first request goes through", "/sample?b=2&a=1", 1, "MISS"},
+		{"same query in another order is served from cache", "/sample/?a=1&b=2", 1, "HIT"},
+		{"another query goes through", "/sample?a=1", 2, "MISS"},
+	}
+
+	for _, tc := range testCases {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest(http.MethodGet, tc.Endpoint, nil))
+		h.Wg.Wait()
+
+		if calls != tc.Calls {
+			t.Errorf("%s: test failed, got: %v calls, want: %v", tc.Scenario, calls, tc.Calls)
+		}
+		if got := w.Header().Get("X-Cache"); got != tc.XCache {
+			t.Errorf("%s: test failed, got: %v, want: %v", tc.Scenario, got, tc.XCache)
+		}
+		if got := w.Header().Get(cacheTagHeader); got != "" {
+			t.Errorf("%s: test failed, cache tags are exposed: %v", tc.Scenario, got)
+		}
+		if got := w.Header().Get("Content-Type"); got != "text/csv" {
+			t.Errorf("%s: test failed, got: %v, want: text/csv", tc.Scenario, got)
+		}
+		if got := w.Body.String(); got != "id,foo\n1,var\n" {
+			t.Errorf("%s: test failed, got: %v", tc.Scenario, got)
+		}
+	}
+
+	// every response with the tag is purged
+	h.purgeCacheTags(context.Background(), sampleListTag)
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodGet, "/sample?a=1&b=2", nil))
+	if calls != 3 {
+		t.Errorf("test failed, got: %v calls after purge, want: 3", calls)
+	}
+}
+
+func TestCacheMiddlewareSkipsErrors(t *testing.T) {
+	h, mr := newTestHandler(t)
+
+	handler := h.CacheMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		h.problemResponse(w, r, newError(http.StatusNotFound, CodeNotFound, "the resource doesn't exist", nil))
+	})
+	handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/sample/1", nil))
+	h.Wg.Wait()
+
+	if keys := mr.Keys(); len(keys) != 0 {
+		t.Errorf("test failed, got: %v, want no cache", keys)
+	}
+}
+
+func TestCacheMiddlewareCoalescesMisses(t *testing.T) {
+	h, _ := newTestHandler(t)
+
+	var mu sync.Mutex
+	calls := 0
+	release := make(chan struct{})
+	handler := h.CacheMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		calls++
+		mu.Unlock()
+		<-release
+		h.negotiatedResponse(w, r, http.StatusOK, "ok")
+	})
+
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := httptest.NewRecorder()
+			handler(w, httptest.NewRequest(http.MethodGet, "/sample/1", nil))
+			if w.Code != http.StatusOK || w.Body.String() != `"ok"` {
+				t.Errorf("test failed, got: %v %v", w.Code, w.Body.String())
+			}
+		}()
+	}
+	// give every request time to join the flight
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if calls != 1 {
+		t.Errorf("test failed, got: %v calls, want: 1", calls)
+	}
+}
+
+func TestCacheMiddlewareServesStale(t *testing.T) {
+	h, _ := newTestHandler(t)
+	h.CacheFreshFor = time.Millisecond
+
+	calls := 0
+	handler := h.CacheMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		h.negotiatedResponse(w, r, http.StatusOK, calls)
+	})
+
+	handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/sample/1", nil))
+	time.Sleep(5 * time.Millisecond)
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodGet, "/sample/1", nil))
+	h.Wg.Wait()
+
+	if got := w.Header().Get("X-Cache"); got != "STALE" {
+		t.Errorf("test failed, got: %v, want: STALE", got)
+	}
+	if got := w.Body.String(); got != "1" {
+		t.Errorf("test failed, got: %v, want the stale body 1", got)
+	}
+	// the background request has refreshed the cache
+	if calls != 2 {
+		t.Errorf("test failed, got: %v calls, want: 2", calls)
+	}
+}
+
+func TestCacheMiddlewareLocalTier(t *testing.T) {
+	h, mr := newTestHandler(t)
+	h.LocalCache = lru.New(10, 0)
+
+	calls := 0
+	handler := h.CacheMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		setCacheTags(w, sampleTag(1))
+		h.negotiatedResponse(w, r, http.StatusOK, "ok")
+	})
+
+	handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/sample/1", nil))
+	// served from the process even though redis lost the data
+	for _, k := range mr.Keys() {
+		if strings.HasPrefix(k, "cache:") {
+			mr.Del(k)
+		}
+	}
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodGet, "/sample/1", nil))
+	if calls != 1 || w.Header().Get("X-Cache") != "HIT" {
+		t.Errorf("test failed, got: %v calls, X-Cache %v", calls, w.Header().Get("X-Cache"))
+	}
+
+	// a purge on another instance reaches this one through pub/sub
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := h.SubscribeCachePurge(ctx); err != nil {
+		t.Fatal(err)
+	}
+	other := NewHandler(&HandlerOptions{
+		Log:   h.Log,
+		Wg:    &sync.WaitGroup{},
+		Redis: h.Redis,
+	})
+	other.purgeCacheTags(context.Background(), sampleTag(1))
+
+	deadline := time.Now().Add(time.Second)
+	for h.LocalCache.Len() != 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if n := h.LocalCache.Len(); n != 0 {
+		t.Errorf("test failed, got: %v local entries after purge, want: 0", n)
+	}
+
+	cancel()
+	h.Wg.Wait()
+}
+
+func TestCacheMiddlewareNotModified(t *testing.T) {
+	h, _ := newTestHandler(t)
+
+	updatedAt := time.Date(2021, 11, 1, 10, 0, 0, 0, time.UTC)
+	handler := h.CacheMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		h.versionedResponse(w, r, http.StatusOK, "ok", 3, updatedAt)
+	})
+
+	type testCase struct {
+		Scenario        string
+		IfModifiedSince string
+		Status          int
+	}
+	testCases := []testCase{
+		// the first request must not store 304 into the cache
+		{"miss with the latest version", updatedAt.Format(http.TimeFormat), http.StatusNotModified},
+		{"hit without condition", "", http.StatusOK},
+		{"hit with the latest version", updatedAt.Format(http.TimeFormat), http.StatusNotModified},
+		{"hit with an old version", updatedAt.Add(-time.Hour).Format(http.TimeFormat), http.StatusOK},
+	}
+
+	for _, tc := range testCases {
+		req := httptest.NewRequest(http.MethodGet, "/sample/1", nil)
+		if tc.IfModifiedSince != "" {
+			req.Header.Set("If-Modified-Since", tc.IfModifiedSince)
+		}
+		w := httptest.NewRecorder()
+		handler(w, req)
+		h.Wg.Wait()
+
+		if w.Code != tc.Status {
+			t.Errorf("%s: test failed, got: %v, want: %v", tc.Scenario, w.Code, tc.Status)
+		}
+		if got := w.Header().Get("Last-Modified"); got != updatedAt.Format(http.TimeFormat) {
+			t.Errorf("%s: test failed, got Last-Modified: %v", tc.Scenario, got)
+		}
+	}
+}
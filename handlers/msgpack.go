@@ -0,0 +1,40 @@
+package handler
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// MessagePack, https://github.com/msgpack/msgpack/blob/master/spec.md
+// The members have the names of JSON, and time.Time is the timestamp extension type.
+
+// encodeMsgpack encodes v by the json tags of its fields
+func encodeMsgpack(w io.Writer, v interface{}) error {
+	enc := msgpack.NewEncoder(w)
+	enc.SetCustomStructTag("json")
+	enc.UseCompactInts(true)
+	return enc.Encode(v)
+}
+
+// decodeMsgpack decodes a MessagePack request body into v as if it was JSON, see decodeJSON
+func decodeMsgpack(body io.Reader, v interface{}) error {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+
+	r := bytes.NewReader(data)
+	var tree interface{}
+	err = msgpack.NewDecoder(r).Decode(&tree)
+	if err == nil && r.Len() != 0 {
+		return newError(http.StatusBadRequest, CodeInvalidBody, "unexpected data after the MessagePack value", nil)
+	}
+	if err != nil {
+		return newError(http.StatusBadRequest, CodeInvalidBody, "the body is not valid MessagePack: "+err.Error(), err)
+	}
+
+	return decodeTree(tree, v)
+}
@@ -0,0 +1,73 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/hex"
+	"net/http"
+	"testing"
+)
+
+func TestEncodeMsgpack(t *testing.T) {
+	type item struct {
+		Name  string `json:"name"`
+		Count int64  `json:"count,omitempty"`
+	}
+
+	type testCase struct {
+		Scenario string
+		Value    interface{}
+		Hex      string
+	}
+	testCases := []testCase{
+		{"names of json", &item{Name: "a", Count: 1}, "82a46e616d65a161a5636f756e7401"},
+		{"omitempty", &item{Name: "a"}, "81a46e616d65a161"},
+		{"compact ints", []int64{-1, 200, -1000}, "93ffccc8d1fc18"},
+	}
+
+	for _, tc := range testCases {
+		var buf bytes.Buffer
+		if err := encodeMsgpack(&buf, tc.Value); err != nil {
+			t.Errorf("%s: expected non error, but some error occurred, %s", tc.Scenario, err.Error())
+			continue
+		}
+		if got := hex.EncodeToString(buf.Bytes()); got != tc.Hex {
+			t.Errorf("%s: test failed, got: %v, want: %v", tc.Scenario, got, tc.Hex)
+		}
+	}
+}
+
+func TestDecodeMsgpack(t *testing.T) {
+	type testCase struct {
+		Scenario string
+		Hex      string
+		Code     ErrorCode
+	}
+	testCases := []testCase{
+		// {"foo": "a", "int_val": 1}
+		{"valid", "82a3666f6fa161a7696e745f76616c01", ""},
+		{"unknown field", "82a3666f6fa161a3626172c0", CodeValidationFailed},
+		{"trailing data", "81a3666f6fa16101", CodeInvalidBody},
+		{"truncated", "82a3666f6f", CodeInvalidBody},
+		{"non string key", "810102", CodeInvalidBody},
+		{"NaN", "81a3666f6fcb7ff8000000000001", CodeInvalidBody},
+	}
+
+	for _, tc := range testCases {
+		data, _ := hex.DecodeString(tc.Hex)
+		req := &SamplePostRequest{}
+		err := decodeMsgpack(bytes.NewReader(data), req)
+		if tc.Code == "" {
+			if err != nil {
+				t.Errorf("%s: expected non error, but some error occurred, %s", tc.Scenario, err.Error())
+			} else if req.Foo != "a" || req.IntVal != 1 {
+				t.Errorf("%s: test failed, got: %+v", tc.Scenario, req)
+			}
+			continue
+		}
+
+		e := bindError(err)
+		if e.Code != tc.Code || e.Status != http.StatusBadRequest {
+			t.Errorf("%s: test failed, got: %v %v, want: %v %v", tc.Scenario, e.Status, e.Code, http.StatusBadRequest, tc.Code)
+		}
+	}
+}
@@ -0,0 +1,360 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// codec encodes response bodies and decodes request bodies of a media type
+type codec struct {
+	mediaType string
+	// aliases are the other names of the media type which are accepted in Accept and Content-Type
+	aliases     []string
+	contentType string
+	encode      func(w io.Writer, v interface{}) error
+	// decode decodes and validates a request body into v, it's nil when request bodies of the type are not accepted
+	decode func(body io.Reader, v interface{}) error
+}
+
+// codecs is the registry of the media types, in the order of preference of the server.
+// JSON is the first one, so that it's used when the client has no preference.
+var codecs = []*codec{
+	{
+		mediaType:   "application/json",
+		contentType: "application/json; charset=UTF-8",
+		encode:      encodeJSON,
+		decode:      decodeJSON,
+	},
+	{
+		mediaType:   "application/msgpack",
+		aliases:     []string{"application/x-msgpack", "application/vnd.msgpack"},
+		contentType: "application/msgpack",
+		encode:      encodeMsgpack,
+		decode:      decodeMsgpack,
+	},
+	{
+		mediaType:   "application/cbor",
+		contentType: "application/cbor",
+		encode:      encodeCBOR,
+		decode:      decodeCBOR,
+	},
+	{
+		mediaType:   "application/xml",
+		aliases:     []string{"text/xml"},
+		contentType: "application/xml; charset=UTF-8",
+		encode:      encodeXML,
+		decode:      decodeXML,
+	},
+	{
+		mediaType:   "text/csv",
+		contentType: "text/csv; charset=UTF-8; header=present",
+		encode:      encodeCSV,
+	},
+}
+
+// errNotEncodable is returned by codec.encode when the value can't be presented in the media type,
+// e.g. an object in CSV. The next acceptable media type is tried then.
+var errNotEncodable = errors.New("the value can't be encoded in the media type")
+
+// errNotAcceptable is the problem when none of the media types in Accept is available
+var errNotAcceptable = func() *Error {
+	types := make([]string, 0, len(codecs))
+	for _, c := range codecs {
+		types = append(types, c.mediaType)
+	}
+	detail := "none of the media types in Accept is available, the response can be " + strings.Join(types, ", ")
+	return newError(http.StatusNotAcceptable, statusCode(http.StatusNotAcceptable), detail, nil)
+}()
+
+// encodeJSON is the encoder of JSON, the other media types have the same names by the json tags
+func encodeJSON(w io.Writer, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+// mediaRange is an element of Accept, RFC 7231 section 5.3.2
+type mediaRange struct {
+	mediaType string
+	q         float64
+}
+
+// parseAccept parses the Accept headers, the invalid elements are ignored
+func parseAccept(headers []string) []*mediaRange {
+	ranges := []*mediaRange{}
+	for _, header := range headers {
+		for _, part := range strings.Split(header, ",") {
+			if strings.TrimSpace(part) == "" {
+				continue
+			}
+			mt, params, err := mime.ParseMediaType(part)
+			if err != nil {
+				continue
+			}
+			q := 1.0
+			if v, ok := params["q"]; ok {
+				q, err = strconv.ParseFloat(v, 64)
+				if err != nil || q < 0 || q > 1 {
+					continue
+				}
+			}
+			ranges = append(ranges, &mediaRange{mediaType: mt, q: q})
+		}
+	}
+
+	return ranges
+}
+
+// subtype is the subtype of the media type, e.g. json, which tells the representation in the entity tags
+func (c *codec) subtype() string {
+	return c.mediaType[strings.IndexByte(c.mediaType, '/')+1:]
+}
+
+// specificity tells how specifically the media range matches the codec,
+// 0 when it doesn't match, then */*, type/* and type/subtype
+func (c *codec) specificity(mediaRange string) int {
+	if mediaRange == "*/*" {
+		return 1
+	}
+	for _, mt := range append([]string{c.mediaType}, c.aliases...) {
+		if mediaRange == mt {
+			return 3
+		}
+		if strings.HasSuffix(mediaRange, "/*") && strings.HasPrefix(mt, strings.TrimSuffix(mediaRange, "*")) {
+			return 2
+		}
+	}
+	return 0
+}
+
+// quality is the q-value of the most specific media range which matches the codec
+func (c *codec) quality(ranges []*mediaRange) float64 {
+	best, q := 0, 0.0
+	for _, mr := range ranges {
+		if s := c.specificity(mr.mediaType); s > best {
+			best, q = s, mr.q
+		}
+	}
+	return q
+}
+
+// acceptableCodecs returns the codecs which the client accepts, from the most preferred one.
+// The order of the server breaks the ties. Every codec is acceptable without Accept.
+func acceptableCodecs(r *http.Request) []*codec {
+	headers := r.Header.Values("Accept")
+	if len(headers) == 0 {
+		return codecs
+	}
+
+	ranges := parseAccept(headers)
+	res := []*codec{}
+	qs := map[*codec]float64{}
+	for _, c := range codecs {
+		if q := c.quality(ranges); q > 0 {
+			res = append(res, c)
+			qs[c] = q
+		}
+	}
+	sort.SliceStable(res, func(i, j int) bool {
+		return qs[res[i]] > qs[res[j]]
+	})
+
+	return res
+}
+
+// requestCodec returns the codec of the request body by Content-Type,
+// a body without Content-Type is JSON. It returns nil when the type is not supported.
+func requestCodec(r *http.Request) *codec {
+	if r.Header.Get("Content-Type") == "" {
+		return codecs[0]
+	}
+	mt := requestMediaType(r)
+	for _, c := range codecs {
+		if c.decode != nil && c.specificity(mt) == 3 {
+			return c
+		}
+	}
+	return nil
+}
+
+// NegotiateMiddleware responds 406 before running the handler when the client accepts none of the media types
+func (h *Handler) NegotiateMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept")
+		if len(acceptableCodecs(r)) == 0 {
+			h.problemResponse(w, r, errNotAcceptable)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// negotiatedResponse responds data with the status in the most preferred media type of Accept
+// which can present data, see codecs. It responds 406 if there is none.
+func (h *Handler) negotiatedResponse(w http.ResponseWriter, r *http.Request, code int, data interface{}) {
+	c, body, err := negotiate(r, data)
+	if err != nil {
+		h.problemResponse(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", c.contentType)
+	w.WriteHeader(code)
+	w.Write(body)
+}
+
+// versionedResponse responds data as negotiatedResponse does, with the validators of the version of the resource,
+// Last-Modified is omitted when lastModified is zero. For GET and HEAD it responds 304 Not Modified instead
+// when the client already has the representation according to If-None-Match or If-Modified-Since.
+func (h *Handler) versionedResponse(w http.ResponseWriter, r *http.Request, code int, data interface{}, version int64, lastModified time.Time) {
+	c, body, err := negotiate(r, data)
+	if err != nil {
+		h.problemResponse(w, r, err)
+		return
+	}
+
+	if !lastModified.IsZero() {
+		w.Header().Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+	w.Header().Set("ETag", versionETag(version, c))
+	if notModified(r, w.Header()) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", c.contentType)
+	w.WriteHeader(code)
+	w.Write(body)
+}
+
+// negotiate encodes data in the most preferred media type of Accept which can present data
+func negotiate(r *http.Request, data interface{}) (*codec, []byte, error) {
+	for _, c := range acceptableCodecs(r) {
+		var buf bytes.Buffer
+		err := c.encode(&buf, data)
+		if errors.Is(err, errNotEncodable) {
+			continue
+		}
+		if err != nil {
+			return nil, nil, internalError(err)
+		}
+		return c, buf.Bytes(), nil
+	}
+
+	return nil, nil, errNotAcceptable
+}
+
+// object is a JSON object which keeps the order of its members, so that the other media types
+// present them in the same order as JSON, e.g. the columns of CSV
+type object struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+func newObject() *object {
+	return &object{values: map[string]interface{}{}}
+}
+
+// set adds or overwrites a member, the last one wins as in encoding/json
+func (o *object) set(key string, value interface{}) {
+	if _, ok := o.values[key]; !ok {
+		o.keys = append(o.keys, key)
+	}
+	o.values[key] = value
+}
+
+func (o *object) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, k := range o.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(k)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(o.values[k])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// maxTreeDepth is the maximum nesting of arrays and maps in the CBOR request bodies
+const maxTreeDepth = 64
+
+// toTree converts v into what it is in JSON, so that every media type presents the same names and values.
+// The values are nil, bool, json.Number, string, []interface{} and *object.
+func toTree(v interface{}) (interface{}, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	return readTree(dec)
+}
+
+func readTree(dec *json.Decoder) (interface{}, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch tok {
+	case json.Delim('{'):
+		o := newObject()
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := readTree(dec)
+			if err != nil {
+				return nil, err
+			}
+			o.set(key.(string), value)
+		}
+		_, err := dec.Token()
+		return o, err
+	case json.Delim('['):
+		arr := []interface{}{}
+		for dec.More() {
+			value, err := readTree(dec)
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, value)
+		}
+		_, err := dec.Token()
+		return arr, err
+	}
+
+	return tok, nil
+}
+
+// decodeTree decodes a value which another codec read from a request body into v as if it was JSON, see decodeJSON
+func decodeTree(tree interface{}, v interface{}) error {
+	b, err := json.Marshal(tree)
+	if err != nil {
+		return newError(http.StatusBadRequest, CodeInvalidBody, err.Error(), err)
+	}
+	return decodeJSON(bytes.NewReader(b), v)
+}
@@ -0,0 +1,201 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	mysql "github.com/sunao-uehara/go-restapi-sample/storages/mysql"
+)
+
+func TestAcceptableCodecs(t *testing.T) {
+	type testCase struct {
+		Scenario string
+		Accept   string
+		Expected []string
+	}
+	testCases := []testCase{
+		{"no preference", "", []string{"application/json", "application/msgpack", "application/cbor", "application/xml", "text/csv"}},
+		{"single type", "text/csv", []string{"text/csv"}},
+		{"alias", "application/x-msgpack", []string{"application/msgpack"}},
+		{"q-values", "application/json;q=0.5, application/cbor", []string{"application/cbor", "application/json"}},
+		{"the most specific range wins", "application/*;q=0.8, application/xml;q=0, */*;q=0.1", []string{"application/json", "application/msgpack", "application/cbor", "text/csv"}},
+		{"invalid q-value is ignored", "text/csv;q=2, application/json", []string{"application/json"}},
+		{"nothing matches", "image/png", []string{}},
+	}
+
+	for _, tc := range testCases {
+		r := httptest.NewRequest(http.MethodGet, "/sample", nil)
+		if tc.Accept != "" {
+			r.Header.Set("Accept", tc.Accept)
+		}
+		got := []string{}
+		for _, c := range acceptableCodecs(r) {
+			got = append(got, c.mediaType)
+		}
+		if strings.Join(got, ",") != strings.Join(tc.Expected, ",") {
+			t.Errorf("%s: test failed, got: %v, want: %v", tc.Scenario, got, tc.Expected)
+		}
+	}
+}
+
+func TestNegotiatedResponse(t *testing.T) {
+	h := NewHandler(&HandlerOptions{Log: zap.NewNop().Sugar()})
+	created := time.Date(2021, 11, 1, 10, 0, 0, 0, time.UTC)
+	sample := &mysql.SampleData{ID: 1, Foo: "=1+1", IntVal: -5, Version: 2, CreatedAt: created, UpdatedAt: created}
+	list := &SampleListResponse{Data: []*mysql.SampleData{sample}, Total: 1, Links: &ListLinks{}}
+
+	type testCase struct {
+		Scenario    string
+		Accept      string
+		Data        interface{}
+		Status      int
+		ContentType string
+		Body        string
+	}
+	testCases := []testCase{
+		{"json", "", sample, http.StatusOK, "application/json; charset=UTF-8",
+			`{"id":1,"foo":"=1+1","int_val":-5,"version":2,"created_at":"2021-11-01T10:00:00Z","updated_at":"2021-11-01T10:00:00Z"}`},
+		{"xml", "application/xml", sample, http.StatusOK, "application/xml; charset=UTF-8",
+			`<?xml version="1.0" encoding="UTF-8"?>` + "\n" + `<response><id>1</id><foo>=1+1</foo><int_val>-5</int_val><version>2</version><created_at>2021-11-01T10:00:00Z</created_at><updated_at>2021-11-01T10:00:00Z</updated_at></response>`},
+		{"xml of a list", "application/xml", list, http.StatusOK, "application/xml; charset=UTF-8",
+			`<?xml version="1.0" encoding="UTF-8"?>` + "\n" + `<response><data><item><id>1</id><foo>=1+1</foo><int_val>-5</int_val><version>2</version><created_at>2021-11-01T10:00:00Z</created_at><updated_at>2021-11-01T10:00:00Z</updated_at></item></data><total>1</total><links></links></response>`},
+		{"xml of a map falls back", "application/xml, application/json;q=0.1", map[string]int{"id": 1}, http.StatusOK, "application/json; charset=UTF-8", `{"id":1}`},
+		{"csv of a list", "text/csv", list, http.StatusOK, "text/csv; charset=UTF-8; header=present",
+			"id,foo,int_val,version,created_at,updated_at\n1,'=1+1,-5,2,2021-11-01T10:00:00Z,2021-11-01T10:00:00Z\n"},
+		{"csv of an object falls back", "text/csv, application/json;q=0.1", map[string]int{"id": 1}, http.StatusOK, "application/json; charset=UTF-8", `{"id":1}`},
+		{"csv only of an object", "text/csv", sample, http.StatusNotAcceptable, contentTypeProblem, ""},
+	}
+
+	for _, tc := range testCases {
+		r := httptest.NewRequest(http.MethodGet, "/sample", nil)
+		if tc.Accept != "" {
+			r.Header.Set("Accept", tc.Accept)
+		}
+		rec := httptest.NewRecorder()
+		h.negotiatedResponse(rec, r, http.StatusOK, tc.Data)
+		if rec.Code != tc.Status {
+			t.Errorf("%s: test failed, got: %v, want: %v", tc.Scenario, rec.Code, tc.Status)
+		}
+		if ct := rec.Header().Get("Content-Type"); ct != tc.ContentType {
+			t.Errorf("%s: test failed, got: %v, want: %v", tc.Scenario, ct, tc.ContentType)
+		}
+		if tc.Body != "" && rec.Body.String() != tc.Body {
+			t.Errorf("%s: test failed, got: %v, want: %v", tc.Scenario, rec.Body.String(), tc.Body)
+		}
+	}
+}
+
+func TestVersionedResponse(t *testing.T) {
+	h := NewHandler(&HandlerOptions{Log: zap.NewNop().Sugar()})
+	sample := &mysql.SampleData{ID: 1, Foo: "a", Version: 3}
+
+	type testCase struct {
+		Scenario    string
+		Accept      string
+		IfNoneMatch string
+		Status      int
+		ETag        string
+	}
+	testCases := []testCase{
+		{"json", "", "", http.StatusOK, `"3-json"`},
+		{"msgpack", "application/msgpack", "", http.StatusOK, `"3-msgpack"`},
+		{"same representation", "application/json", `"3-json"`, http.StatusNotModified, `"3-json"`},
+		{"another representation", "application/msgpack", `"3-json"`, http.StatusOK, `"3-msgpack"`},
+		{"csv falls back to json", "text/csv, application/json;q=0.1", "", http.StatusOK, `"3-json"`},
+	}
+
+	for _, tc := range testCases {
+		r := httptest.NewRequest(http.MethodGet, "/sample/1", nil)
+		if tc.Accept != "" {
+			r.Header.Set("Accept", tc.Accept)
+		}
+		if tc.IfNoneMatch != "" {
+			r.Header.Set("If-None-Match", tc.IfNoneMatch)
+		}
+		rec := httptest.NewRecorder()
+		h.versionedResponse(rec, r, http.StatusOK, sample, sample.Version, time.Time{})
+		if rec.Code != tc.Status {
+			t.Errorf("%s: test failed, got: %v, want: %v", tc.Scenario, rec.Code, tc.Status)
+		}
+		if etag := rec.Header().Get("ETag"); etag != tc.ETag {
+			t.Errorf("%s: test failed, got: %v, want: %v", tc.Scenario, etag, tc.ETag)
+		}
+	}
+}
+
+func TestNegotiateMiddleware(t *testing.T) {
+	h := NewHandler(&HandlerOptions{Log: zap.NewNop().Sugar()})
+	called := false
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	})
+
+	r := httptest.NewRequest(http.MethodPost, "/sample", nil)
+	r.Header.Set("Accept", "image/png")
+	rec := httptest.NewRecorder()
+	h.NegotiateMiddleware(next).ServeHTTP(rec, r)
+	if rec.Code != http.StatusNotAcceptable || called {
+		t.Errorf("test failed, got: %v, %v, want: %v, false", rec.Code, called, http.StatusNotAcceptable)
+	}
+	if v := rec.Header().Get("Vary"); v != "Accept" {
+		t.Errorf("test failed, got: %v, want: Accept", v)
+	}
+}
+
+func TestDecodeRequestByContentType(t *testing.T) {
+	large := strings.Repeat("a", maxRequestBodyBytes)
+
+	type testCase struct {
+		Scenario    string
+		ContentType string
+		Body        string
+		Status      int
+		Field       string
+	}
+	testCases := []testCase{
+		{"json without Content-Type", "", `{"foo": "a", "int_val": 1}`, 0, ""},
+		{"xml", "text/xml", `<sample><foo>a</foo><int_val> 1 </int_val></sample>`, 0, ""},
+		{"xml with a wrong type", "application/xml", `<sample><foo>a</foo><int_val>one</int_val></sample>`, http.StatusBadRequest, ""},
+		{"xml with an unknown element", "application/xml", `<sample><foo>a</foo><bar>1</bar></sample>`, http.StatusBadRequest, "bar"},
+		{"invalid xml", "application/xml", `<sample><foo>a</sample>`, http.StatusBadRequest, ""},
+		// {"foo": "a", "int_val": 1}
+		{"msgpack", "application/msgpack", "\x82\xa3foo\xa1a\xa7int_val\x01", 0, ""},
+		{"cbor", "application/cbor", "\xa2\x63foo\x61a\x67int_val\x01", 0, ""},
+		{"validation of cbor", "application/cbor", "\xa1\x67int_val\x01", http.StatusBadRequest, "foo"},
+		{"unsupported type", "text/plain", `foo=a`, http.StatusUnsupportedMediaType, ""},
+		{"too large json", "application/json", `{"foo": "` + large + `"}`, http.StatusRequestEntityTooLarge, ""},
+		{"too large msgpack", "application/msgpack", "\x81\xa3foo\xdb\x00\x10\x00\x00" + large, http.StatusRequestEntityTooLarge, ""},
+		{"too large cbor", "application/cbor", "\xa1\x63foo\x7a\x00\x10\x00\x00" + large, http.StatusRequestEntityTooLarge, ""},
+		{"too large xml", "application/xml", `<sample><foo>` + large + `</foo></sample>`, http.StatusRequestEntityTooLarge, ""},
+	}
+
+	for _, tc := range testCases {
+		r := httptest.NewRequest(http.MethodPost, "/sample", strings.NewReader(tc.Body))
+		if tc.ContentType != "" {
+			r.Header.Set("Content-Type", tc.ContentType)
+		}
+		req := &SamplePostRequest{}
+		err := DecodeRequest(r, req)
+		if tc.Status == 0 {
+			if err != nil {
+				t.Errorf("%s: expected non error, but some error occurred, %s", tc.Scenario, err.Error())
+			} else if req.Foo != "a" || req.IntVal != 1 {
+				t.Errorf("%s: test failed, got: %v", tc.Scenario, req)
+			}
+			continue
+		}
+
+		e := bindError(err)
+		if e.Status != tc.Status {
+			t.Errorf("%s: test failed, got: %v, want: %v", tc.Scenario, e.Status, tc.Status)
+		}
+		if tc.Field != "" && (len(e.Fields) != 1 || e.Fields[0].Field != tc.Field) {
+			t.Errorf("%s: test failed, got: %v, want: %v", tc.Scenario, e.Fields, tc.Field)
+		}
+	}
+}
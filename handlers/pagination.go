@@ -0,0 +1,211 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	mysql "github.com/sunao-uehara/go-restapi-sample/storages/mysql"
+)
+
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+)
+
+// reserved query parameters, every other parameter is treated as a filter
+var paginationParams = map[string]bool{
+	"limit":  true,
+	"offset": true,
+	"after":  true,
+	"before": true,
+	"sort":   true,
+}
+
+// filterSuffixes are checked in order, so that `_gte` wins over `_gt`
+var filterSuffixes = []string{"gte", "lte", "gt", "lt", "ne", "eq"}
+
+// ListLinks holds the URLs of the neighbour pages, empty when there is no such page
+type ListLinks struct {
+	Next string `json:"next,omitempty" xml:"next,omitempty"`
+	Prev string `json:"prev,omitempty" xml:"prev,omitempty"`
+}
+
+// parseListOptions converts the query string into mysql.ListOptions.
+// e.g. ?limit=10&after=42&sort=foo,-int_val&foo=bar&int_val_gte=10
+// Columns are not validated here, the storage query builder rejects unknown ones.
+func parseListOptions(q url.Values) (*mysql.ListOptions, error) {
+	opts := &mysql.ListOptions{Limit: defaultPageLimit}
+
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxPageLimit {
+			return nil, fmt.Errorf("limit must be between 1 and %d", maxPageLimit)
+		}
+		opts.Limit = limit
+	}
+	if v := q.Get("offset"); v != "" {
+		offset, err := strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			return nil, fmt.Errorf("offset must be a non-negative integer")
+		}
+		opts.Offset = offset
+	}
+	if v := q.Get("after"); v != "" {
+		after, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || after < 1 {
+			return nil, fmt.Errorf("after must be a positive integer")
+		}
+		opts.After = after
+	}
+	if v := q.Get("before"); v != "" {
+		before, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || before < 1 {
+			return nil, fmt.Errorf("before must be a positive integer")
+		}
+		opts.Before = before
+	}
+	if opts.After > 0 && opts.Before > 0 {
+		return nil, fmt.Errorf("after and before cannot be used together")
+	}
+
+	if v := q.Get("sort"); v != "" {
+		for _, s := range strings.Split(v, ",") {
+			s = strings.TrimSpace(s)
+			desc := strings.HasPrefix(s, "-")
+			s = strings.TrimPrefix(s, "-")
+			if s == "" {
+				return nil, fmt.Errorf("invalid sort parameter: %q", v)
+			}
+			opts.Sort = append(opts.Sort, mysql.SortField{Column: s, Desc: desc})
+		}
+	}
+
+	for key, values := range q {
+		if paginationParams[key] {
+			continue
+		}
+		column, op := key, "eq"
+		for _, suffix := range filterSuffixes {
+			if strings.HasSuffix(key, "_"+suffix) {
+				column, op = strings.TrimSuffix(key, "_"+suffix), suffix
+				break
+			}
+		}
+		for _, v := range values {
+			opts.Filters = append(opts.Filters, mysql.Filter{Column: column, Op: op, Value: v})
+		}
+	}
+
+	return opts, nil
+}
+
+// listPage is a page of a collection read by listCollection. The rows of the page are rows[start:end]
+// of the ones the list function fetched.
+type listPage struct {
+	start int
+	end   int
+	total int64
+	links *ListLinks
+}
+
+// listCollection runs the list flow of GET of a collection with the query parameters of r, see parseListOptions.
+// list fetches the rows of opts, keeps them and returns their ids in order. One extra row is fetched to find out
+// whether there is a next page. count returns the number of rows matching the filters of opts.
+// The errors can be responded with problemResponse.
+func listCollection(r *http.Request, list func(ctx context.Context, opts *mysql.ListOptions) ([]int64, error),
+	count func(ctx context.Context, opts *mysql.ListOptions) (int64, error)) (*listPage, error) {
+	opts, err := parseListOptions(r.URL.Query())
+	if err != nil {
+		return nil, invalidParameterError(err.Error(), err)
+	}
+
+	fetch := *opts
+	fetch.Limit = opts.Limit + 1
+	ids, err := list(r.Context(), &fetch)
+	if err != nil {
+		return nil, err
+	}
+	start, end, hasMore := trimPage(len(ids), opts)
+
+	total, err := count(r.Context(), opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &listPage{
+		start: start,
+		end:   end,
+		total: total,
+		links: listLinks(r, opts, ids[start:end], hasMore, total),
+	}, nil
+}
+
+// trimPage drops the extra row of the n rows fetched with Limit+1 of opts, it returns the range of the rows
+// in the page and whether a row exists beyond the page in the walking direction
+func trimPage(n int, opts *mysql.ListOptions) (start int, end int, hasMore bool) {
+	if n <= opts.Limit {
+		return 0, n, false
+	}
+	if opts.Before > 0 {
+		return 1, n, true
+	}
+	return 0, opts.Limit, true
+}
+
+// listLinks builds the next/prev links of the page which was fetched with opts.
+// ids are the ids of the returned rows, hasMore tells whether a row exists beyond
+// the page in the walking direction, total is the number of matching rows.
+func listLinks(r *http.Request, opts *mysql.ListOptions, ids []int64, hasMore bool, total int64) *ListLinks {
+	links := &ListLinks{}
+
+	link := func(set map[string]string) string {
+		q := r.URL.Query()
+		for _, k := range []string{"offset", "after", "before"} {
+			q.Del(k)
+		}
+		for k, v := range set {
+			q.Set(k, v)
+		}
+		return r.URL.Path + "?" + q.Encode()
+	}
+
+	// offset pagination
+	if opts.Offset > 0 || !opts.SortedByID() {
+		if int64(opts.Offset+len(ids)) < total {
+			links.Next = link(map[string]string{"offset": strconv.Itoa(opts.Offset + opts.Limit)})
+		}
+		if opts.Offset > 0 {
+			prev := opts.Offset - opts.Limit
+			if prev < 0 {
+				prev = 0
+			}
+			links.Prev = link(map[string]string{"offset": strconv.Itoa(prev)})
+		}
+		return links
+	}
+
+	// cursor pagination
+	if len(ids) == 0 {
+		return links
+	}
+	first := strconv.FormatInt(ids[0], 10)
+	last := strconv.FormatInt(ids[len(ids)-1], 10)
+	if opts.Before > 0 {
+		links.Next = link(map[string]string{"after": last})
+		if hasMore {
+			links.Prev = link(map[string]string{"before": first})
+		}
+		return links
+	}
+	if hasMore {
+		links.Next = link(map[string]string{"after": last})
+	}
+	if opts.After > 0 {
+		links.Prev = link(map[string]string{"before": first})
+	}
+	return links
+}
@@ -0,0 +1,153 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+
+	mysql "github.com/sunao-uehara/go-restapi-sample/storages/mysql"
+)
+
+func TestParseListOptions(t *testing.T) {
+	type testCase struct {
+		Scenario string
+		In       string
+		Expected *mysql.ListOptions
+		Error    bool
+	}
+
+	testCases := []testCase{
+		{
+			"default",
+			"",
+			&mysql.ListOptions{Limit: defaultPageLimit},
+			false,
+		},
+		{
+			"sort and filters",
+			"limit=5&sort=foo,-int_val&foo=bar&int_val_gte=10",
+			&mysql.ListOptions{
+				Limit: 5,
+				Sort: []mysql.SortField{
+					{Column: "foo"},
+					{Column: "int_val", Desc: true},
+				},
+				Filters: []mysql.Filter{
+					{Column: "foo", Op: "eq", Value: "bar"},
+					{Column: "int_val", Op: "gte", Value: "10"},
+				},
+			},
+			false,
+		},
+		{
+			"cursor",
+			"after=42",
+			&mysql.ListOptions{Limit: defaultPageLimit, After: 42},
+			false,
+		},
+		{"failure case, limit too large", "limit=1000", nil, true},
+		{"failure case, negative offset", "offset=-1", nil, true},
+		{"failure case, after and before", "after=1&before=3", nil, true},
+		{"failure case, empty sort field", "sort=foo,", nil, true},
+	}
+
+	for _, tc := range testCases {
+		q, _ := url.ParseQuery(tc.In)
+		got, err := parseListOptions(q)
+		if tc.Error {
+			if err == nil {
+				t.Errorf("%s: expected error, but results: no error", tc.Scenario)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: expected non error, but some error occurred, %s", tc.Scenario, err.Error())
+			continue
+		}
+		// filters come from a map, so the order is not stable
+		if len(got.Filters) == 2 && got.Filters[0].Column != "foo" {
+			got.Filters[0], got.Filters[1] = got.Filters[1], got.Filters[0]
+		}
+		if !reflect.DeepEqual(tc.Expected, got) {
+			t.Errorf("%s: test failed, got: %+v, want: %+v", tc.Scenario, got, tc.Expected)
+		}
+	}
+}
+
+func TestListLinks(t *testing.T) {
+	r := httptest.NewRequest("GET", "/sample?limit=2&after=2&foo=bar", nil)
+	opts, _ := parseListOptions(r.URL.Query())
+
+	got := listLinks(r, opts, []int64{3, 4}, true, 10)
+	want := &ListLinks{
+		Next: "/sample?after=4&foo=bar&limit=2",
+		Prev: "/sample?before=3&foo=bar&limit=2",
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("test failed, got: %+v, want: %+v", got, want)
+	}
+
+	r = httptest.NewRequest("GET", "/sample?limit=2&offset=8&sort=foo", nil)
+	opts, _ = parseListOptions(r.URL.Query())
+
+	got = listLinks(r, opts, []int64{5, 1}, false, 10)
+	want = &ListLinks{
+		Prev: "/sample?limit=2&offset=6&sort=foo",
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("test failed, got: %+v, want: %+v", got, want)
+	}
+}
+
+func TestTrimPage(t *testing.T) {
+	type testCase struct {
+		Scenario string
+		N        int
+		Opts     *mysql.ListOptions
+		Expected [3]interface{}
+	}
+	testCases := []testCase{
+		{"last page", 2, &mysql.ListOptions{Limit: 2}, [3]interface{}{0, 2, false}},
+		{"more rows after", 3, &mysql.ListOptions{Limit: 2}, [3]interface{}{0, 2, true}},
+		{"more rows before", 3, &mysql.ListOptions{Limit: 2, Before: 5}, [3]interface{}{1, 3, true}},
+	}
+
+	for _, tc := range testCases {
+		start, end, hasMore := trimPage(tc.N, tc.Opts)
+		if got := [3]interface{}{start, end, hasMore}; got != tc.Expected {
+			t.Errorf("%s: test failed, got: %v, want: %v", tc.Scenario, got, tc.Expected)
+		}
+	}
+}
+
+func TestListCollection(t *testing.T) {
+	list := func(ctx context.Context, opts *mysql.ListOptions) ([]int64, error) {
+		if opts.Limit != 3 {
+			return nil, fmt.Errorf("unexpected limit %d", opts.Limit)
+		}
+		return []int64{1, 2, 3}, nil
+	}
+	count := func(ctx context.Context, opts *mysql.ListOptions) (int64, error) {
+		return 5, nil
+	}
+
+	r := httptest.NewRequest("GET", "/samples?limit=2", nil)
+	page, err := listCollection(r, list, count)
+	if err != nil {
+		t.Fatalf("expected non error, but some error occurred, %s", err)
+	}
+	if got, want := [3]interface{}{page.start, page.end, page.total}, [3]interface{}{0, 2, int64(5)}; got != want {
+		t.Errorf("test failed, got: %v, want: %v", got, want)
+	}
+	if want := "/samples?after=2&limit=2"; page.links.Next != want {
+		t.Errorf("test failed, got: %v, want: %v", page.links.Next, want)
+	}
+
+	r = httptest.NewRequest("GET", "/samples?limit=0", nil)
+	if _, err := listCollection(r, list, count); err == nil {
+		t.Errorf("expected error, but no error occurred")
+	}
+}
@@ -0,0 +1,112 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	chi "github.com/go-chi/chi/v5"
+)
+
+// ParamParser parses the raw value of a URL parameter, the error message is shown to the client
+type ParamParser struct {
+	Code  string
+	Parse func(value string) (interface{}, error)
+}
+
+var (
+	uuidRe = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	slugRe = regexp.MustCompile(`^[a-z0-9]+(?:-[a-z0-9]+)*$`)
+)
+
+// the parsers of URL parameters, see PathParams
+var (
+	// PositiveInt64 is an int64 greater than zero, e.g. an id
+	PositiveInt64 = &ParamParser{Code: "invalid_type", Parse: func(value string) (interface{}, error) {
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || n <= 0 {
+			return nil, errors.New("must be a positive integer")
+		}
+		return n, nil
+	}}
+	// UUID is a UUID in the canonical form, it's parsed into the lower case string
+	UUID = &ParamParser{Code: "invalid_format", Parse: func(value string) (interface{}, error) {
+		if !uuidRe.MatchString(value) {
+			return nil, errors.New("must be a UUID")
+		}
+		return strings.ToLower(value), nil
+	}}
+	// Slug is lower case alphanumeric words joined by hyphens
+	Slug = &ParamParser{Code: "invalid_format", Parse: func(value string) (interface{}, error) {
+		if !slugRe.MatchString(value) {
+			return nil, errors.New("must be lower case letters and digits joined by hyphens")
+		}
+		return value, nil
+	}}
+)
+
+type pathParamsCtxKey struct{}
+
+// PathParams is a middleware for chi routes which parses the URL parameters with their parsers
+// before the handler, and responds 400 problem details when any of them is invalid.
+// The handler reads the values with pathInt64 or pathString instead of chi.URLParam.
+// It has to be an inline middleware, e.g. r.With(...).Get(...), since the parameters are known after routing.
+func (h *Handler) PathParams(params map[string]*ParamParser) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			names := make([]string, 0, len(params))
+			for name := range params {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+
+			values := map[string]interface{}{}
+			fields := []*FieldError{}
+			for _, name := range names {
+				p := params[name]
+				v, err := p.Parse(chi.URLParam(r, name))
+				if err != nil {
+					fields = append(fields, &FieldError{Field: name, Code: p.Code, Message: err.Error()})
+					continue
+				}
+				values[name] = v
+			}
+			if len(fields) > 0 {
+				h.problemResponse(w, r, &Error{
+					Status: http.StatusBadRequest,
+					Code:   CodeInvalidParameter,
+					Detail: "the URL has invalid parameters",
+					Fields: fields,
+				})
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(withPathParams(r.Context(), values)))
+		})
+	}
+}
+
+func withPathParams(ctx context.Context, values map[string]interface{}) context.Context {
+	return context.WithValue(ctx, pathParamsCtxKey{}, values)
+}
+
+func pathParams(ctx context.Context) map[string]interface{} {
+	values, _ := ctx.Value(pathParamsCtxKey{}).(map[string]interface{})
+	return values
+}
+
+// pathInt64 returns the URL parameter parsed by PathParams, ok is false when the route doesn't have it
+func pathInt64(r *http.Request, name string) (int64, bool) {
+	v, ok := pathParams(r.Context())[name].(int64)
+	return v, ok
+}
+
+// pathString returns the URL parameter parsed by PathParams, ok is false when the route doesn't have it
+func pathString(r *http.Request, name string) (string, bool) {
+	v, ok := pathParams(r.Context())[name].(string)
+	return v, ok
+}
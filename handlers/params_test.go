@@ -0,0 +1,103 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	chi "github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+func TestPathParams(t *testing.T) {
+	h := NewHandler(&HandlerOptions{Log: zap.NewNop().Sugar()})
+
+	r := chi.NewRouter()
+	r.With(h.PathParams(map[string]*ParamParser{"id": PositiveInt64, "slug": Slug})).Get("/{id}/{slug}", func(w http.ResponseWriter, r *http.Request) {
+		id, _ := pathInt64(r, "id")
+		slug, _ := pathString(r, "slug")
+		h.negotiatedResponse(w, r, http.StatusOK, map[string]interface{}{"id": id, "slug": slug})
+	})
+
+	type testCase struct {
+		Scenario string
+		Path     string
+		Status   int
+		Fields   []string
+	}
+	testCases := []testCase{
+		{"valid", "/12/foo-bar", http.StatusOK, nil},
+		{"not a number", "/abc/foo", http.StatusBadRequest, []string{"id"}},
+		{"zero", "/0/foo", http.StatusBadRequest, []string{"id"}},
+		{"negative", "/-1/foo", http.StatusBadRequest, []string{"id"}},
+		{"overflow", "/9223372036854775808/foo", http.StatusBadRequest, []string{"id"}},
+		{"every invalid parameter is reported", "/abc/Foo_Bar", http.StatusBadRequest, []string{"id", "slug"}},
+	}
+
+	for _, tc := range testCases {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tc.Path, nil))
+		if rec.Code != tc.Status {
+			t.Errorf("%s: test failed, got: %v, want: %v", tc.Scenario, rec.Code, tc.Status)
+			continue
+		}
+		if tc.Status == http.StatusOK {
+			continue
+		}
+
+		if ct := rec.Header().Get("Content-Type"); ct != contentTypeProblem {
+			t.Errorf("%s: test failed, got: %v, want: %v", tc.Scenario, ct, contentTypeProblem)
+		}
+		p := &Problem{}
+		if err := json.Unmarshal(rec.Body.Bytes(), p); err != nil {
+			t.Errorf("%s: expected non error, but some error occurred, %s", tc.Scenario, err.Error())
+			continue
+		}
+		if p.Code != CodeInvalidParameter || len(p.Errors) != len(tc.Fields) {
+			t.Errorf("%s: test failed, got: %v, want: %v", tc.Scenario, p, tc.Fields)
+			continue
+		}
+		for i, f := range p.Errors {
+			if f.Field != tc.Fields[i] {
+				t.Errorf("%s: test failed, got: %v, want: %v", tc.Scenario, f.Field, tc.Fields[i])
+			}
+		}
+	}
+}
+
+func TestParamParser(t *testing.T) {
+	type testCase struct {
+		Scenario string
+		Parser   *ParamParser
+		Value    string
+		Expected interface{}
+	}
+	testCases := []testCase{
+		{"positive int64", PositiveInt64, "42", int64(42)},
+		{"int64 with a sign", PositiveInt64, "+42", int64(42)},
+		{"not an int64", PositiveInt64, "4.2", nil},
+		{"UUID", UUID, "123E4567-e89b-12d3-a456-426614174000", "123e4567-e89b-12d3-a456-426614174000"},
+		{"UUID without hyphens", UUID, "123e4567e89b12d3a456426614174000", nil},
+		{"slug", Slug, "hello-world-2", "hello-world-2"},
+		{"slug with a trailing hyphen", Slug, "hello-", nil},
+		{"empty slug", Slug, "", nil},
+	}
+
+	for _, tc := range testCases {
+		got, err := tc.Parser.Parse(tc.Value)
+		if tc.Expected == nil {
+			if err == nil {
+				t.Errorf("%s: expected error, but no error occurred, got: %v", tc.Scenario, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: expected non error, but some error occurred, %s", tc.Scenario, err.Error())
+			continue
+		}
+		if got != tc.Expected {
+			t.Errorf("%s: test failed, got: %v, want: %v", tc.Scenario, got, tc.Expected)
+		}
+	}
+}
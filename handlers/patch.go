@@ -0,0 +1,191 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+const (
+	// contentTypeMergePatch is JSON Merge Patch, RFC 7396
+	contentTypeMergePatch = "application/merge-patch+json"
+	// contentTypeJSONPatch is JSON Patch, RFC 6902
+	contentTypeJSONPatch = "application/json-patch+json"
+)
+
+// errPatchTestFailed is returned when a `test` operation of JSON Patch doesn't match the current resource
+var errPatchTestFailed = errors.New("patch test operation failed")
+
+// patchError converts an error of applying a patch, the messages are safe to show
+func patchError(err error) *Error {
+	if errors.Is(err, errPatchTestFailed) {
+		return newError(http.StatusConflict, CodeConflict, err.Error(), err)
+	}
+	return newError(http.StatusBadRequest, CodeInvalidBody, err.Error(), err)
+}
+
+// requestMediaType returns the media type of Content-Type without parameters, e.g. charset
+func requestMediaType(r *http.Request) string {
+	mt, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return ""
+	}
+	return mt
+}
+
+// jsonPatchOperation is an operation of JSON Patch. Only test, add, replace and remove are supported,
+// since the resources have fixed members.
+type jsonPatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value"`
+}
+
+// patchDocument is a resource as a JSON object, which patches are applied to.
+// writable maps the members which can be modified to their zero value.
+type patchDocument struct {
+	members  map[string]json.RawMessage
+	writable map[string]json.RawMessage
+	changed  []string
+}
+
+// newPatchDocument converts the resource v into a document, writable is the list of
+// members which can be modified with the zero value of each, e.g. {"foo": `""`}
+func newPatchDocument(v interface{}, writable map[string]json.RawMessage) (*patchDocument, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	members := map[string]json.RawMessage{}
+	if err := json.Unmarshal(b, &members); err != nil {
+		return nil, err
+	}
+
+	return &patchDocument{members: members, writable: writable}, nil
+}
+
+func (d *patchDocument) set(member string, value json.RawMessage) error {
+	zero, ok := d.writable[member]
+	if !ok {
+		return fmt.Errorf("%s cannot be modified", member)
+	}
+	// null removes the member, which means the default value for a fixed schema
+	if len(value) == 0 || string(value) == "null" {
+		value = zero
+	}
+	d.members[member] = value
+	for _, c := range d.changed {
+		if c == member {
+			return nil
+		}
+	}
+	d.changed = append(d.changed, member)
+	return nil
+}
+
+// decode stores the patched resource into v and returns the members which were modified
+func (d *patchDocument) decode(v interface{}) ([]string, error) {
+	b, err := json.Marshal(d.members)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return nil, fmt.Errorf("invalid value: %w", err)
+	}
+
+	return d.changed, nil
+}
+
+// applyMergePatch applies JSON Merge Patch read from body. A member which is present
+// and null resets it to the zero value.
+func (d *patchDocument) applyMergePatch(body io.Reader) error {
+	patch := map[string]json.RawMessage{}
+	dec := json.NewDecoder(body)
+	if err := dec.Decode(&patch); err != nil {
+		return fmt.Errorf("invalid merge patch: %w", err)
+	}
+	if dec.More() {
+		return errors.New("invalid merge patch: unexpected data after the object")
+	}
+
+	for member, value := range patch {
+		if err := d.set(member, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyJSONPatch applies JSON Patch read from body. The operations are applied in order
+// and errPatchTestFailed is returned when a test operation doesn't match.
+func (d *patchDocument) applyJSONPatch(body io.Reader) error {
+	ops := []*jsonPatchOperation{}
+	dec := json.NewDecoder(body)
+	if err := dec.Decode(&ops); err != nil {
+		return fmt.Errorf("invalid json patch: %w", err)
+	}
+	if dec.More() {
+		return errors.New("invalid json patch: unexpected data after the array")
+	}
+
+	for i, op := range ops {
+		member, err := jsonPointerMember(op.Path)
+		if err != nil {
+			return fmt.Errorf("operation %d: %w", i, err)
+		}
+
+		switch op.Op {
+		case "test":
+			current, ok := d.members[member]
+			if !ok || !equalJSON(current, op.Value) {
+				return fmt.Errorf("%w: %s", errPatchTestFailed, op.Path)
+			}
+		case "add", "replace":
+			if len(op.Value) == 0 {
+				return fmt.Errorf("operation %d: missing value", i)
+			}
+			if err := d.set(member, op.Value); err != nil {
+				return fmt.Errorf("operation %d: %w", i, err)
+			}
+		case "remove":
+			if err := d.set(member, nil); err != nil {
+				return fmt.Errorf("operation %d: %w", i, err)
+			}
+		default:
+			return fmt.Errorf("operation %d: unsupported op %q", i, op.Op)
+		}
+	}
+	return nil
+}
+
+// jsonPointerMember returns the member referenced by a JSON Pointer, RFC 6901.
+// Only the top level members can be referenced.
+func jsonPointerMember(pointer string) (string, error) {
+	if !strings.HasPrefix(pointer, "/") {
+		return "", fmt.Errorf("invalid path %q", pointer)
+	}
+	member := pointer[1:]
+	if strings.Contains(member, "/") {
+		return "", fmt.Errorf("unsupported path %q", pointer)
+	}
+	member = strings.ReplaceAll(member, "~1", "/")
+	member = strings.ReplaceAll(member, "~0", "~")
+
+	return member, nil
+}
+
+func equalJSON(a, b json.RawMessage) bool {
+	var va, vb interface{}
+	if err := json.Unmarshal(a, &va); err != nil {
+		return false
+	}
+	if err := json.Unmarshal(b, &vb); err != nil {
+		return false
+	}
+	return reflect.DeepEqual(va, vb)
+}
@@ -0,0 +1,164 @@
+package handler
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	mysql "github.com/sunao-uehara/go-restapi-sample/storages/mysql"
+)
+
+func TestApplyMergePatch(t *testing.T) {
+	type out struct {
+		Foo    string
+		IntVal int64
+		Fields []string
+		Err    bool
+	}
+	type testCase struct {
+		Scenario string
+		Body     string
+		Expected out
+	}
+	testCases := []testCase{
+		{"set zero value", `{"int_val": 0}`, out{"bar", 0, []string{"int_val"}, false}},
+		{"null resets the field", `{"foo": null}`, out{"", 5, []string{"foo"}, false}},
+		{"both fields", `{"foo": "baz", "int_val": 7}`, out{"baz", 7, nil, false}},
+		{"read only field", `{"version": 9}`, out{Err: true}},
+		{"wrong type", `{"int_val": "abc"}`, out{Err: true}},
+		{"trailing data", `{"foo": "baz"} {}`, out{Err: true}},
+	}
+
+	for _, tc := range testCases {
+		d := &mysql.SampleData{ID: 1, Foo: "bar", IntVal: 5, Version: 2}
+		doc, err := newPatchDocument(d, sampleWritableMembers)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = doc.applyMergePatch(strings.NewReader(tc.Body))
+		var fields []string
+		if err == nil {
+			fields, err = doc.decode(d)
+		}
+		if (err != nil) != tc.Expected.Err {
+			t.Errorf("%s: test failed, got: %v, want error: %v", tc.Scenario, err, tc.Expected.Err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if d.Foo != tc.Expected.Foo || d.IntVal != tc.Expected.IntVal {
+			t.Errorf("%s: test failed, got: %v, %v, want: %v, %v", tc.Scenario, d.Foo, d.IntVal, tc.Expected.Foo, tc.Expected.IntVal)
+		}
+		if tc.Expected.Fields != nil && !reflect.DeepEqual(fields, tc.Expected.Fields) {
+			t.Errorf("%s: test failed, got: %v, want: %v", tc.Scenario, fields, tc.Expected.Fields)
+		}
+		if d.Version != 2 {
+			t.Errorf("%s: test failed, version was modified: %v", tc.Scenario, d.Version)
+		}
+	}
+}
+
+func TestDecodeSamplePatch(t *testing.T) {
+	type testCase struct {
+		Scenario string
+		Body     string
+		Code     ErrorCode
+	}
+	testCases := []testCase{
+		{"valid", `{"foo": "baz"}`, ""},
+		{"too long", `{"foo": "` + strings.Repeat("a", 256) + `"}`, CodeValidationFailed},
+		{"out of range", `{"int_val": 2147483648}`, CodeValidationFailed},
+		{"wrong type", `{"int_val": "abc"}`, CodeInvalidBody},
+	}
+
+	for _, tc := range testCases {
+		d := &mysql.SampleData{}
+		doc, _ := newPatchDocument(d, sampleWritableMembers)
+		if err := doc.applyMergePatch(strings.NewReader(tc.Body)); err != nil {
+			t.Fatal(err)
+		}
+		_, err := decodeSamplePatch(doc, d)
+		var code ErrorCode
+		if err != nil {
+			code = toError(err).Code
+		}
+		if code != tc.Code {
+			t.Errorf("%s: test failed, got: %v, want: %v", tc.Scenario, err, tc.Code)
+		}
+	}
+}
+
+func TestApplyJSONPatch(t *testing.T) {
+	type out struct {
+		Foo        string
+		IntVal     int64
+		Fields     []string
+		TestFailed bool
+		Err        bool
+	}
+	type testCase struct {
+		Scenario string
+		Body     string
+		Expected out
+	}
+	testCases := []testCase{
+		{"replace with zero value", `[{"op": "replace", "path": "/int_val", "value": 0}]`, out{"bar", 0, []string{"int_val"}, false, false}},
+		{"remove resets the field", `[{"op": "remove", "path": "/foo"}]`, out{"", 5, []string{"foo"}, false, false}},
+		{"test then replace", `[{"op": "test", "path": "/version", "value": 2}, {"op": "replace", "path": "/foo", "value": "baz"}]`, out{"baz", 5, []string{"foo"}, false, false}},
+		{"test fails", `[{"op": "test", "path": "/foo", "value": "qux"}, {"op": "replace", "path": "/foo", "value": "baz"}]`, out{TestFailed: true, Err: true}},
+		{"read only field", `[{"op": "replace", "path": "/id", "value": 3}]`, out{Err: true}},
+		{"nested path", `[{"op": "replace", "path": "/foo/0", "value": "x"}]`, out{Err: true}},
+		{"unsupported op", `[{"op": "move", "from": "/foo", "path": "/int_val"}]`, out{Err: true}},
+		{"missing value", `[{"op": "replace", "path": "/foo"}]`, out{Err: true}},
+	}
+
+	for _, tc := range testCases {
+		d := &mysql.SampleData{ID: 1, Foo: "bar", IntVal: 5, Version: 2}
+		doc, err := newPatchDocument(d, sampleWritableMembers)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = doc.applyJSONPatch(strings.NewReader(tc.Body))
+		var fields []string
+		if err == nil {
+			fields, err = doc.decode(d)
+		}
+		if (err != nil) != tc.Expected.Err || errors.Is(err, errPatchTestFailed) != tc.Expected.TestFailed {
+			t.Errorf("%s: test failed, got: %v, want error: %v", tc.Scenario, err, tc.Expected.Err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if d.Foo != tc.Expected.Foo || d.IntVal != tc.Expected.IntVal {
+			t.Errorf("%s: test failed, got: %v, %v, want: %v, %v", tc.Scenario, d.Foo, d.IntVal, tc.Expected.Foo, tc.Expected.IntVal)
+		}
+		if !reflect.DeepEqual(fields, tc.Expected.Fields) {
+			t.Errorf("%s: test failed, got: %v, want: %v", tc.Scenario, fields, tc.Expected.Fields)
+		}
+	}
+}
+
+func TestJSONPointerMember(t *testing.T) {
+	type testCase struct {
+		Pointer  string
+		Expected string
+		Err      bool
+	}
+	testCases := []testCase{
+		{"/foo", "foo", false},
+		{"/a~1b", "a/b", false},
+		{"/m~0n", "m~n", false},
+		{"foo", "", true},
+		{"/foo/bar", "", true},
+	}
+
+	for _, tc := range testCases {
+		got, err := jsonPointerMember(tc.Pointer)
+		if got != tc.Expected || (err != nil) != tc.Err {
+			t.Errorf("test failed, got: %v, %v, want: %v, error: %v", got, err, tc.Expected, tc.Err)
+		}
+	}
+}
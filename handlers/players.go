@@ -0,0 +1,210 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	mysql "github.com/sunao-uehara/go-restapi-sample/storages/mysql"
+)
+
+// playerListTag is the cache tag of every list of players
+const playerListTag = "player:list"
+
+// playerTag is the cache tag of every response which contains the player
+func playerTag(id int64) string {
+	return fmt.Sprintf("player:%d", id)
+}
+
+// errMissingPlayerID is the error when the route doesn't parse playerId with PathParams
+var errMissingPlayerID = invalidParameterError("missing playerId", nil)
+
+type PlayersPostRequest struct {
+	Name  string `json:"name" xml:"name" validate:"required,maxlen=255"`
+	Level int64  `json:"level" xml:"level" validate:"min=0,max=2147483647"`
+	Score int64  `json:"score" xml:"score" validate:"min=0,max=2147483647"`
+}
+
+func (ppr *PlayersPostRequest) Bind(r *http.Request) error {
+	return nil
+}
+
+func (h *Handler) PlayersPostHandler(w http.ResponseWriter, r *http.Request) {
+	h.logger(r.Context()).Debug("PlayersPostHandler")
+	ctx := r.Context()
+
+	req := &PlayersPostRequest{}
+	if err := bindRequest(r, req); err != nil {
+		h.problemResponse(w, r, bindError(err))
+		return
+	}
+
+	pc := mysql.NewPlayer(h.Mysql)
+	id, err := pc.CreatePlayer(ctx, &mysql.PlayerData{Name: req.Name, Level: req.Level, Score: req.Score})
+	if err != nil {
+		h.problemResponse(w, r, err)
+		return
+	}
+
+	h.goSafe(r.Context(), func() {
+		// purge cache
+		h.purgeCacheTags(detachContext(r.Context()), playerListTag)
+	})
+
+	// read it again for the defaults of the table, see SamplePostHandler
+	d, err := pc.GetPlayer(ctx, id)
+	if err != nil {
+		h.logger(r.Context()).Warn(err.Error())
+		d = &mysql.PlayerData{ID: id, Name: req.Name, Level: req.Level, Score: req.Score}
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("/api/players/%d", id))
+	h.negotiatedResponse(w, r, http.StatusCreated, d)
+}
+
+// PlayerListResponse is the response of GET /api/players
+type PlayerListResponse struct {
+	Data  []*mysql.PlayerData `json:"data" xml:"data>item"`
+	Total int64               `json:"total" xml:"total"`
+	Links *ListLinks          `json:"links" xml:"links,omitempty"`
+}
+
+func (res *PlayerListResponse) rows() interface{} {
+	return res.Data
+}
+
+func (h *Handler) PlayersGetHandler(w http.ResponseWriter, r *http.Request) {
+	h.logger(r.Context()).Debug("PlayersGetHandler")
+	ctx := r.Context()
+
+	pc := mysql.NewPlayer(h.Mysql)
+
+	if id, ok := pathInt64(r, "playerId"); ok {
+		data, err := pc.GetPlayer(ctx, id)
+		if err != nil {
+			h.problemResponse(w, r, err)
+			return
+		}
+
+		setCacheTags(w, playerTag(id))
+		h.negotiatedResponse(w, r, http.StatusOK, data)
+		return
+	}
+
+	var rows []*mysql.PlayerData
+	page, err := listCollection(r, func(ctx context.Context, opts *mysql.ListOptions) ([]int64, error) {
+		var err error
+		rows, err = pc.ListPlayer(ctx, opts)
+		ids := make([]int64, 0, len(rows))
+		for _, d := range rows {
+			ids = append(ids, d.ID)
+		}
+		return ids, err
+	}, pc.CountPlayer)
+	if err != nil {
+		h.problemResponse(w, r, err)
+		return
+	}
+	data := &PlayerListResponse{
+		Data:  rows[page.start:page.end],
+		Total: page.total,
+		Links: page.links,
+	}
+
+	setCacheTags(w, playerListTag)
+	h.negotiatedResponse(w, r, http.StatusOK, data)
+}
+
+// PlayersPatchRequest is the body of PATCH of a player, the fields which are present are updated, zero values included
+type PlayersPatchRequest struct {
+	Name  *string `json:"name,omitempty" xml:"name" validate:"maxlen=255"`
+	Level *int64  `json:"level,omitempty" xml:"level" validate:"min=0,max=2147483647"`
+	Score *int64  `json:"score,omitempty" xml:"score" validate:"min=0,max=2147483647"`
+}
+
+func (ppr *PlayersPatchRequest) Bind(r *http.Request) error {
+	if ppr.Name == nil && ppr.Level == nil && ppr.Score == nil {
+		return newError(http.StatusBadRequest, CodeInvalidBody, "missing patch fields", nil)
+	}
+
+	return nil
+}
+
+func (h *Handler) PlayersPatchHandler(w http.ResponseWriter, r *http.Request) {
+	h.logger(r.Context()).Debug("PlayersPatchHandler")
+	ctx := r.Context()
+
+	req := &PlayersPatchRequest{}
+	if err := bindRequest(r, req); err != nil {
+		h.problemResponse(w, r, bindError(err))
+		return
+	}
+
+	id, ok := pathInt64(r, "playerId")
+	if !ok {
+		h.problemResponse(w, r, errMissingPlayerID)
+		return
+	}
+
+	pc := mysql.NewPlayer(h.Mysql)
+	d := &mysql.PlayerData{}
+	fields := make([]string, 0, 3)
+	if req.Name != nil {
+		d.Name = *req.Name
+		fields = append(fields, "name")
+	}
+	if req.Level != nil {
+		d.Level = *req.Level
+		fields = append(fields, "level")
+	}
+	if req.Score != nil {
+		d.Score = *req.Score
+		fields = append(fields, "score")
+	}
+	updated, err := pc.PatchPlayer(ctx, id, d, fields)
+	if err != nil {
+		h.problemResponse(w, r, err)
+		return
+	}
+
+	h.goSafe(r.Context(), func() {
+		// purge cache
+		h.purgeCacheTags(detachContext(r.Context()), playerTag(id), playerListTag)
+	})
+
+	if preferMinimal(r) {
+		w.Header().Set("Preference-Applied", "return=minimal")
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	h.negotiatedResponse(w, r, http.StatusOK, updated)
+}
+
+func (h *Handler) PlayersDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	h.logger(r.Context()).Debug("PlayersDeleteHandler")
+	ctx := r.Context()
+
+	id, ok := pathInt64(r, "playerId")
+	if !ok {
+		h.problemResponse(w, r, errMissingPlayerID)
+		return
+	}
+
+	pc := mysql.NewPlayer(h.Mysql)
+	rowsAffected, err := pc.DeletePlayer(ctx, id)
+	if err != nil {
+		h.problemResponse(w, r, err)
+		return
+	}
+	if rowsAffected == 0 {
+		h.problemResponse(w, r, mysql.ErrNotFound)
+		return
+	}
+
+	h.goSafe(r.Context(), func() {
+		// purge cache
+		h.purgeCacheTags(detachContext(r.Context()), playerTag(id), playerListTag)
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,115 @@
+package handler_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/sunao-uehara/go-restapi-sample/testutils"
+)
+
+func TestPlayersHandlers(t *testing.T) {
+	s := newTestServer(t, "players")
+
+	notFound := `{"type":"urn:problem-type:not_found","title":"Not Found","status":404,
+		"detail":"the resource doesn't exist","instance":"/api/players/1","code":"not_found"}`
+	testCases := []handlerTestCase{
+		{
+			Scenario: "create",
+			Method:   http.MethodPost,
+			In:       testutils.HandlerInput{Endpoint: "/api/players", RequestBody: `{"name":"alice","level":3}`},
+			Out: testutils.HandlerOutput{
+				ResponseStatusCode: http.StatusCreated,
+				ResponseBody:       `{"id":1,"name":"alice","level":3,"score":0}`,
+			},
+			Location: "/api/players/1",
+		},
+		{
+			Scenario: "create with the default level",
+			Method:   http.MethodPost,
+			In:       testutils.HandlerInput{Endpoint: "/api/players", RequestBody: `{"name":"bob"}`},
+			Out: testutils.HandlerOutput{
+				ResponseStatusCode: http.StatusCreated,
+				ResponseBody:       `{"id":2,"name":"bob","level":1,"score":0}`,
+			},
+			Location: "/api/players/2",
+		},
+		{
+			Scenario: "failure case, create without name",
+			Method:   http.MethodPost,
+			In:       testutils.HandlerInput{Endpoint: "/api/players", RequestBody: `{"level":3}`},
+			Out:      testutils.HandlerOutput{ResponseStatusCode: http.StatusBadRequest},
+		},
+		{
+			Scenario: "get",
+			Method:   http.MethodGet,
+			In:       testutils.HandlerInput{Endpoint: "/api/players/1"},
+			Out: testutils.HandlerOutput{
+				ResponseStatusCode: http.StatusOK,
+				ResponseBody:       `{"id":1,"name":"alice","level":3,"score":0}`,
+			},
+		},
+		{
+			Scenario: "list",
+			Method:   http.MethodGet,
+			In:       testutils.HandlerInput{Endpoint: "/api/players?limit=1"},
+			Out: testutils.HandlerOutput{
+				ResponseStatusCode: http.StatusOK,
+				ResponseBody: `{"data":[{"id":1,"name":"alice","level":3,"score":0}],"total":2,
+					"links":{"next":"/api/players?after=1&limit=1"}}`,
+			},
+		},
+		{
+			Scenario: "patch",
+			Method:   http.MethodPatch,
+			In:       testutils.HandlerInput{Endpoint: "/api/players/1", RequestBody: `{"score":10}`},
+			Out: testutils.HandlerOutput{
+				ResponseStatusCode: http.StatusOK,
+				ResponseBody:       `{"id":1,"name":"alice","level":3,"score":10}`,
+			},
+		},
+		{
+			Scenario: "get after patch",
+			Method:   http.MethodGet,
+			In:       testutils.HandlerInput{Endpoint: "/api/players/1"},
+			Out: testutils.HandlerOutput{
+				ResponseStatusCode: http.StatusOK,
+				ResponseBody:       `{"id":1,"name":"alice","level":3,"score":10}`,
+			},
+		},
+		{
+			Scenario: "patch to the zero value",
+			Method:   http.MethodPatch,
+			In:       testutils.HandlerInput{Endpoint: "/api/players/1", RequestBody: `{"score":0}`},
+			Out: testutils.HandlerOutput{
+				ResponseStatusCode: http.StatusOK,
+				ResponseBody:       `{"id":1,"name":"alice","level":3,"score":0}`,
+			},
+		},
+		{
+			Scenario: "delete",
+			Method:   http.MethodDelete,
+			In:       testutils.HandlerInput{Endpoint: "/api/players/1"},
+			Out:      testutils.HandlerOutput{ResponseStatusCode: http.StatusNoContent},
+		},
+		{
+			Scenario: "failure case, get after delete",
+			Method:   http.MethodGet,
+			In:       testutils.HandlerInput{Endpoint: "/api/players/1"},
+			Out:      testutils.HandlerOutput{ResponseStatusCode: http.StatusNotFound, ResponseBody: notFound},
+		},
+		{
+			Scenario: "failure case, patch a missing player",
+			Method:   http.MethodPatch,
+			In:       testutils.HandlerInput{Endpoint: "/api/players/1", RequestBody: `{"score":20}`},
+			Out:      testutils.HandlerOutput{ResponseStatusCode: http.StatusNotFound, ResponseBody: notFound},
+		},
+		{
+			Scenario: "failure case, delete a missing player",
+			Method:   http.MethodDelete,
+			In:       testutils.HandlerInput{Endpoint: "/api/players/1"},
+			Out:      testutils.HandlerOutput{ResponseStatusCode: http.StatusNotFound, ResponseBody: notFound},
+		},
+	}
+
+	s.run(t, testCases)
+}
@@ -0,0 +1,77 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// the sources of the recovered panics, the label of panics_recovered_total
+const (
+	panicSourceHTTP       = "http"
+	panicSourceBackground = "background"
+)
+
+// RecoverMiddleware recovers a panic of the handler, logs it with the stack and responds 500 problem details.
+// It has to be used with Router.Use after StatsMiddleware, so that the response is recorded as 500.
+func (h *Handler) RecoverMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sw := &statsWriter{ResponseWriter: w}
+		defer func() {
+			rec := recover()
+			if rec == nil {
+				return
+			}
+			// net/http aborts the response silently with it, see http.ErrAbortHandler
+			if rec == http.ErrAbortHandler {
+				panic(rec)
+			}
+
+			h.recordPanic(r.Context(), panicSourceHTTP, rec)
+			// the response has started, it can't be replaced and the client gets it truncated
+			if sw.status != 0 {
+				return
+			}
+			p := newProblem(internalError(nil))
+			p.Instance = r.URL.RequestURI()
+			writeProblem(sw, p)
+		}()
+
+		next.ServeHTTP(sw, r)
+	})
+}
+
+// goSafe runs f in a goroutine which Wg waits for, e.g. the cache purge after a response.
+// A panic in f is recovered and logged with the logger of ctx, so that a bug in background work doesn't crash the server.
+func (h *Handler) goSafe(ctx context.Context, f func()) {
+	h.Wg.Add(1)
+	go func() {
+		defer h.Wg.Done()
+		defer func() {
+			if rec := recover(); rec != nil {
+				h.recordPanic(ctx, panicSourceBackground, rec)
+			}
+		}()
+
+		f()
+	}()
+}
+
+// recordPanic logs the recovered value rec with the stack of the panic, counts it and marks the span of ctx as an error.
+// It has to be called in the deferred function which recovered rec.
+func (h *Handler) recordPanic(ctx context.Context, source string, rec interface{}) {
+	h.stats.panics.WithLabelValues(source).Inc()
+	h.logger(ctx).Errorw("panic recovered",
+		"source", source,
+		"panic", fmt.Sprint(rec),
+		"stack", string(debug.Stack()),
+	)
+
+	span := trace.SpanFromContext(ctx)
+	span.RecordError(fmt.Errorf("panic: %v", rec))
+	span.SetStatus(codes.Error, "panic")
+}
@@ -0,0 +1,124 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestRecoverMiddleware(t *testing.T) {
+	core, logs := observer.New(zap.ErrorLevel)
+	h := NewHandler(&HandlerOptions{Log: zap.New(core).Sugar()})
+
+	type testCase struct {
+		Scenario string
+		Handler  http.HandlerFunc
+		Status   int
+		Problem  bool
+	}
+	testCases := []testCase{
+		{"nil dereference", func(w http.ResponseWriter, r *http.Request) {
+			var req *SamplePostRequest
+			w.Write([]byte(req.Foo))
+		}, http.StatusInternalServerError, true},
+		{"after the response started", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+			panic("broken")
+		}, http.StatusOK, false},
+	}
+
+	for _, tc := range testCases {
+		logs.TakeAll()
+		req := httptest.NewRequest(http.MethodGet, "/sample/1", nil)
+		req.Header.Set(RequestIDHeader, "req-1")
+		rec := httptest.NewRecorder()
+		h.RequestIDMiddleware(h.RecoverMiddleware(tc.Handler)).ServeHTTP(rec, req)
+
+		if rec.Code != tc.Status {
+			t.Errorf("%s: test failed, got: %v, want: %v", tc.Scenario, rec.Code, tc.Status)
+		}
+		if tc.Problem {
+			p := &Problem{}
+			if err := json.Unmarshal(rec.Body.Bytes(), p); err != nil || p.Status != http.StatusInternalServerError || p.Instance != "/sample/1" {
+				t.Errorf("%s: test failed, got: %s, want a problem of 500", tc.Scenario, rec.Body.String())
+			}
+			if ct := rec.Header().Get("Content-Type"); ct != contentTypeProblem {
+				t.Errorf("%s: test failed, got: %v, want: %v", tc.Scenario, ct, contentTypeProblem)
+			}
+		}
+
+		entries := logs.TakeAll()
+		if len(entries) != 1 {
+			t.Fatalf("%s: test failed, got: %v log entries, want: 1", tc.Scenario, len(entries))
+		}
+		fields := entries[0].ContextMap()
+		if fields["request_id"] != "req-1" || fields["source"] != panicSourceHTTP {
+			t.Errorf("%s: test failed, got: %v", tc.Scenario, fields)
+		}
+		if stack, _ := fields["stack"].(string); !strings.Contains(stack, "recover_test.go") {
+			t.Errorf("%s: test failed, got: %v, want the stack of the panic", tc.Scenario, stack)
+		}
+	}
+
+	if got, want := metricsText(h), `panics_recovered_total{source="http"} 2`; !strings.Contains(got, want+"\n") {
+		t.Errorf("test failed, got: %v, want: %v", got, want)
+	}
+}
+
+func TestRecoverMiddlewareAbortHandler(t *testing.T) {
+	h := NewHandler(&HandlerOptions{Log: zap.NewNop().Sugar()})
+	defer func() {
+		if rec := recover(); rec != http.ErrAbortHandler {
+			t.Errorf("test failed, got: %v, want: %v", rec, http.ErrAbortHandler)
+		}
+	}()
+
+	handler := h.RecoverMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+}
+
+func TestGoSafe(t *testing.T) {
+	core, logs := observer.New(zap.ErrorLevel)
+	h := NewHandler(&HandlerOptions{Log: zap.New(core).Sugar(), Wg: &sync.WaitGroup{}})
+
+	var ctx context.Context
+	h.RequestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx = r.Context()
+	})).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodDelete, "/sample/1", nil))
+
+	done := false
+	h.goSafe(ctx, func() {
+		var m map[string]int
+		m["purged"]++
+	})
+	h.goSafe(ctx, func() {
+		done = true
+	})
+	// the panic doesn't crash the test, and Wg is done
+	h.Wg.Wait()
+
+	if !done {
+		t.Errorf("test failed, got: %v, want: %v", done, true)
+	}
+	entries := logs.TakeAll()
+	if len(entries) != 1 {
+		t.Fatalf("test failed, got: %v log entries, want: 1", len(entries))
+	}
+	fields := entries[0].ContextMap()
+	if fields["request_id"] != requestID(ctx) || fields["source"] != panicSourceBackground {
+		t.Errorf("test failed, got: %v", fields)
+	}
+
+	if got, want := metricsText(h), `panics_recovered_total{source="background"} 1`; !strings.Contains(got, want+"\n") {
+		t.Errorf("test failed, got: %v, want: %v", got, want)
+	}
+}
@@ -0,0 +1,113 @@
+package handler
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"regexp"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// RequestIDHeader is the header of the request ID. It's taken from the request when it's valid,
+// e.g. set by a proxy, otherwise a new one is generated. It's always echoed in the response.
+const RequestIDHeader = "X-Request-ID"
+
+// requestIDRe bounds the request IDs given by the client, since they are written into the logs
+var requestIDRe = regexp.MustCompile(`^[A-Za-z0-9._:+=/-]{1,128}$`)
+
+type requestIDCtxKey struct{}
+type loggerCtxKey struct{}
+
+// RequestIDMiddleware puts the request ID and a logger with it into the context, see logger.
+// It has to be the first middleware, so that the others log with the request ID.
+func (h *Handler) RequestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !requestIDRe.MatchString(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+
+		log := h.Log.With("request_id", id, "remote_ip", remoteIP(r))
+		ctx := context.WithValue(r.Context(), requestIDCtxKey{}, id)
+		ctx = context.WithValue(ctx, loggerCtxKey{}, log)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// AccessLogMiddleware writes a line per request after it's served. It has to be used with Router.Use
+// after RequestIDMiddleware.
+func (h *Handler) AccessLogMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := &statsWriter{ResponseWriter: w}
+		next.ServeHTTP(sw, r)
+		if sw.status == 0 {
+			sw.status = http.StatusOK
+		}
+
+		h.logger(r.Context()).Infow("access",
+			"method", r.Method,
+			"path", r.URL.RequestURI(),
+			"status", sw.status,
+			"bytes", sw.size,
+			"latency", time.Since(start),
+			"user_agent", r.UserAgent(),
+		)
+	})
+}
+
+// logger returns the logger of the request with the request ID, the remote IP and the route once it's routed.
+// h.Log is returned when ctx has no request.
+func (h *Handler) logger(ctx context.Context) *zap.SugaredLogger {
+	log, ok := ctx.Value(loggerCtxKey{}).(*zap.SugaredLogger)
+	if !ok {
+		log = h.Log
+	}
+	if route := routePattern(ctx); route != "" {
+		log = log.With("route", route)
+	}
+	return log
+}
+
+// requestID returns the request ID of ctx, it's empty when ctx has no request
+func requestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDCtxKey{}).(string)
+	return id
+}
+
+// detachContext returns a context for the work outliving the request, it keeps the request ID
+// and the logger of ctx but not its cancellation. The span of ctx is kept as a link, see startLinkedSpan.
+func detachContext(ctx context.Context) context.Context {
+	detached := context.Background()
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		detached = context.WithValue(detached, linkCtxKey{}, sc)
+	}
+	if id := requestID(ctx); id != "" {
+		detached = context.WithValue(detached, requestIDCtxKey{}, id)
+	}
+	if log, ok := ctx.Value(loggerCtxKey{}).(*zap.SugaredLogger); ok {
+		detached = context.WithValue(detached, loggerCtxKey{}, log)
+	}
+	return detached
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// remoteIP is the IP of the peer, it's the proxy when the API is behind one
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,104 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	chi "github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestRequestIDMiddleware(t *testing.T) {
+	h := NewHandler(&HandlerOptions{Log: zap.NewNop().Sugar()})
+
+	type testCase struct {
+		Scenario string
+		Header   string
+		Kept     bool
+	}
+	testCases := []testCase{
+		{"given by the proxy", "f2a1c3e0-8b4d-4c4e-9a57-0c8d1f2e3b4a", true},
+		{"missing", "", false},
+		{"too long", string(make([]byte, 129)), false},
+		{"unsafe characters", "id\nforged log line", false},
+	}
+
+	for _, tc := range testCases {
+		var inContext string
+		next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			inContext = requestID(r.Context())
+		})
+		req := httptest.NewRequest(http.MethodGet, "/sample", nil)
+		if tc.Header != "" {
+			req.Header.Set(RequestIDHeader, tc.Header)
+		}
+		rec := httptest.NewRecorder()
+		h.RequestIDMiddleware(next).ServeHTTP(rec, req)
+
+		got := rec.Header().Get(RequestIDHeader)
+		if got == "" || got != inContext {
+			t.Errorf("%s: test failed, got: %v, want: %v in the context", tc.Scenario, got, inContext)
+		}
+		if kept := got == tc.Header; kept != tc.Kept {
+			t.Errorf("%s: test failed, got: %v, want kept: %v", tc.Scenario, got, tc.Kept)
+		}
+	}
+}
+
+func TestAccessLogMiddleware(t *testing.T) {
+	core, logs := observer.New(zap.DebugLevel)
+	h := NewHandler(&HandlerOptions{Log: zap.New(core).Sugar()})
+
+	r := chi.NewRouter()
+	r.Use(h.RequestIDMiddleware)
+	r.Use(h.AccessLogMiddleware)
+	r.Get("/sample/{sampleId}", func(w http.ResponseWriter, r *http.Request) {
+		h.logger(r.Context()).Info("in handler")
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("12345"))
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/sample/1?q=a", nil)
+	req.Header.Set(RequestIDHeader, "req-1")
+	req.Header.Set("User-Agent", "test-agent")
+	req.RemoteAddr = "192.0.2.1:1234"
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	entries := logs.AllUntimed()
+	if len(entries) != 2 {
+		t.Fatalf("test failed, got: %v log entries, want: 2", len(entries))
+	}
+	handlerLog := entries[0].ContextMap()
+	for k, want := range map[string]interface{}{
+		"request_id": "req-1",
+		"remote_ip":  "192.0.2.1",
+		"route":      "/sample/{sampleId}",
+	} {
+		if got := handlerLog[k]; got != want {
+			t.Errorf("%s: test failed, got: %v, want: %v", k, got, want)
+		}
+	}
+
+	if msg := entries[1].Message; msg != "access" {
+		t.Errorf("test failed, got: %v, want: %v", msg, "access")
+	}
+	accessLog := entries[1].ContextMap()
+	for k, want := range map[string]interface{}{
+		"request_id": "req-1",
+		"route":      "/sample/{sampleId}",
+		"method":     http.MethodGet,
+		"path":       "/sample/1?q=a",
+		"status":     int64(http.StatusNotFound),
+		"bytes":      int64(5),
+		"user_agent": "test-agent",
+	} {
+		if got := accessLog[k]; got != want {
+			t.Errorf("%s: test failed, got: %v (%T), want: %v", k, got, got, want)
+		}
+	}
+	if _, ok := accessLog["latency"]; !ok {
+		t.Errorf("test failed, got: %v, want: latency", accessLog)
+	}
+}
@@ -0,0 +1,191 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	chi "github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/sunao-uehara/go-restapi-sample/analytics"
+)
+
+// unmatchedRoute is the route label of the requests which match no route, e.g. 404
+const unmatchedRoute = "unmatched"
+
+// requestStats is the request metrics. They are labeled by the route pattern rather than the path,
+// so that the number of the series is bounded.
+type requestStats struct {
+	requests     *prometheus.CounterVec
+	duration     *prometheus.HistogramVec
+	responseSize *prometheus.HistogramVec
+	inFlight     *prometheus.GaugeVec
+	// panics is the number of the panics recovered by RecoverMiddleware and goSafe
+	panics *prometheus.CounterVec
+}
+
+func newRequestStats(reg prometheus.Registerer) *requestStats {
+	f := promauto.With(reg)
+	return &requestStats{
+		requests: f.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_requests_total",
+			Help: "The number of HTTP requests.",
+		}, []string{"route", "method", "status"}),
+		duration: f.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "http_request_duration_seconds",
+			Help:    "The latency of HTTP requests.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"route", "method", "status"}),
+		responseSize: f.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "http_response_size_bytes",
+			Help:    "The size of HTTP response bodies.",
+			Buckets: prometheus.ExponentialBuckets(100, 10, 6),
+		}, []string{"route", "method", "status"}),
+		// the route and the status are not known until the request is finished
+		inFlight: f.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "http_requests_in_flight",
+			Help: "The number of HTTP requests being served.",
+		}, []string{"method"}),
+		panics: f.NewCounterVec(prometheus.CounterOpts{
+			Name: "panics_recovered_total",
+			Help: "The number of recovered panics.",
+		}, []string{"source"}),
+	}
+}
+
+// statsWriter is a http.ResponseWriter which records the status and the size of the response
+type statsWriter struct {
+	http.ResponseWriter
+	status int
+	size   int
+}
+
+func (sw *statsWriter) WriteHeader(code int) {
+	if sw.status == 0 {
+		sw.status = code
+	}
+	sw.ResponseWriter.WriteHeader(code)
+}
+
+func (sw *statsWriter) Write(b []byte) (int, error) {
+	if sw.status == 0 {
+		sw.status = http.StatusOK
+	}
+	n, err := sw.ResponseWriter.Write(b)
+	sw.size += n
+	return n, err
+}
+
+func (sw *statsWriter) Flush() {
+	if f, ok := sw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the original http.ResponseWriter for http.ResponseController
+func (sw *statsWriter) Unwrap() http.ResponseWriter {
+	return sw.ResponseWriter
+}
+
+// StatsMiddleware records the number, the latency and the response size of the requests
+// and the requests in flight, see MetricsHandler. An analytics event of every request is emitted
+// when Analytics is configured. It has to be used with Router.Use, the route pattern is read
+// after the request is routed.
+func (h *Handler) StatsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method := methodLabel(r.Method)
+		inFlight := h.stats.inFlight.WithLabelValues(method)
+		inFlight.Inc()
+		defer inFlight.Dec()
+
+		start := time.Now()
+		sw := &statsWriter{ResponseWriter: w}
+		next.ServeHTTP(sw, r)
+		if sw.status == 0 {
+			sw.status = http.StatusOK
+		}
+
+		elapsed := time.Since(start)
+		route, status := routeLabel(r), statusLabel(sw.status)
+		h.stats.requests.WithLabelValues(route, method, status).Inc()
+		h.stats.duration.WithLabelValues(route, method, status).Observe(elapsed.Seconds())
+		h.stats.responseSize.WithLabelValues(route, method, status).Observe(float64(sw.size))
+
+		if h.Analytics != nil {
+			h.Analytics.Emit(&analytics.Event{
+				TransID:     transID(r),
+				Endpoint:    route,
+				Method:      method,
+				Status:      sw.status,
+				ElapsedTime: float64(elapsed) / float64(time.Millisecond),
+				Time:        start,
+			})
+		}
+	})
+}
+
+// transID is the request ID, or a new one when RequestIDMiddleware is not used
+func transID(r *http.Request) string {
+	if id := requestID(r.Context()); id != "" {
+		return id
+	}
+	return analytics.NewTransID()
+}
+
+// StartAnalytics ships the analytics events in background until ctx is canceled,
+// the queued events are flushed before Wg is done. It's a no-op when Analytics is not configured.
+func (h *Handler) StartAnalytics(ctx context.Context) {
+	if h.Analytics == nil {
+		return
+	}
+
+	h.goSafe(ctx, func() {
+		h.Analytics.Run(ctx)
+	})
+}
+
+// MetricsHandler serves the metrics of Metrics in the Prometheus exposition formats
+func (h *Handler) MetricsHandler(w http.ResponseWriter, r *http.Request) {
+	h.metricsHandler.ServeHTTP(w, r)
+}
+
+// routeLabel is the route pattern of the request, e.g. /sample/{sampleId}, see routePattern
+func routeLabel(r *http.Request) string {
+	if pattern := routePattern(r.Context()); pattern != "" {
+		return pattern
+	}
+	return unmatchedRoute
+}
+
+// routePattern is the chi route pattern of ctx without the trailing slash of the sub routers,
+// it's empty until the request is routed
+func routePattern(ctx context.Context) string {
+	rctx := chi.RouteContext(ctx)
+	if rctx == nil {
+		return ""
+	}
+	pattern := rctx.RoutePattern()
+	if pattern != "/" {
+		pattern = strings.TrimSuffix(pattern, "/")
+	}
+	return pattern
+}
+
+// methodLabel bounds the method label, since the method is given by the client
+func methodLabel(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodOptions:
+		return method
+	}
+	return "OTHER"
+}
+
+// statusLabel is the class of the status, e.g. 2xx
+func statusLabel(status int) string {
+	return strconv.Itoa(status/100) + "xx"
+}
@@ -0,0 +1,104 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	chi "github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+
+	"github.com/sunao-uehara/go-restapi-sample/analytics"
+)
+
+func TestStatsMiddleware(t *testing.T) {
+	h := NewHandler(&HandlerOptions{Log: zap.NewNop().Sugar()})
+
+	r := chi.NewRouter()
+	r.Use(h.StatsMiddleware)
+	r.Route("/sample", func(r chi.Router) {
+		r.Get("/{sampleId}", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("12345"))
+		})
+	})
+
+	for _, path := range []string{"/sample/1", "/sample/2", "/unknown"} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	req := httptest.NewRequest("PURGE", "/sample/1", nil)
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	got := metricsText(h)
+	for _, want := range []string{
+		`http_requests_total{method="GET",route="/sample/{sampleId}",status="2xx"} 2`,
+		`http_requests_total{method="GET",route="unmatched",status="4xx"} 1`,
+		`http_requests_total{method="OTHER",route="unmatched",status="4xx"} 1`,
+		`http_response_size_bytes_sum{method="GET",route="/sample/{sampleId}",status="2xx"} 10`,
+		`http_request_duration_seconds_count{method="GET",route="/sample/{sampleId}",status="2xx"} 2`,
+		`http_requests_in_flight{method="GET"} 0`,
+	} {
+		if !strings.Contains(got, want+"\n") {
+			t.Errorf("test failed, got: %v, want: %v", got, want)
+		}
+	}
+
+	// the registry of NewHandler has the runtime metrics
+	if !strings.Contains(got, "\ngo_goroutines ") {
+		t.Errorf("test failed, got: %v, want: go_goroutines", got)
+	}
+}
+
+// metricsText is the metrics of h which MetricsHandler serves in the text format
+func metricsText(h *Handler) string {
+	rec := httptest.NewRecorder()
+	h.MetricsHandler(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	return rec.Body.String()
+}
+
+// analyticsSink keeps the events written
+type analyticsSink struct {
+	mu     sync.Mutex
+	events []*analytics.Event
+}
+
+func (s *analyticsSink) Write(ctx context.Context, events []*analytics.Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, events...)
+	return nil
+}
+
+func TestStatsMiddlewareAnalytics(t *testing.T) {
+	sink := &analyticsSink{}
+	h := NewHandler(&HandlerOptions{
+		Log:       zap.NewNop().Sugar(),
+		Wg:        &sync.WaitGroup{},
+		Analytics: analytics.NewPipeline(sink, &analytics.Options{FlushInterval: time.Hour, ContainerID: "c1"}),
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	h.StartAnalytics(ctx)
+
+	r := chi.NewRouter()
+	r.Use(h.StatsMiddleware)
+	r.Get("/sample/{sampleId}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/sample/1", nil))
+
+	// the events are flushed at the shutdown
+	cancel()
+	h.Wg.Wait()
+	if len(sink.events) != 1 {
+		t.Fatalf("test failed, got: %v events, want: 1", len(sink.events))
+	}
+	e := sink.events[0]
+	if e.Endpoint != "/sample/{sampleId}" || e.Method != http.MethodGet || e.Status != http.StatusNotFound ||
+		e.ContainerID != "c1" || len(e.TransID) != 32 || e.ElapsedTime < 0 {
+		t.Errorf("test failed, got: %+v", e)
+	}
+}
@@ -0,0 +1,129 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	chi "github.com/go-chi/chi/v5"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// newTestTracer installs a tracer provider recording the spans into the returned exporter
+func newTestTracer() *tracetest.InMemoryExporter {
+	exp := tracetest.NewInMemoryExporter()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exp)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	return exp
+}
+
+func TestTracingMiddleware(t *testing.T) {
+	exp := newTestTracer()
+	h := NewHandler(&HandlerOptions{Log: zap.NewNop().Sugar()})
+
+	r := chi.NewRouter()
+	r.Use(h.RequestIDMiddleware)
+	r.Use(h.TracingMiddleware)
+	r.Route("/sample", func(r chi.Router) {
+		r.Get("/{sampleId}", func(w http.ResponseWriter, r *http.Request) {
+			_, span := otel.Tracer("test").Start(r.Context(), "SELECT")
+			span.End()
+			if r.URL.Query().Get("fail") != "" {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+		})
+	})
+
+	type testCase struct {
+		Scenario    string
+		Path        string
+		TraceParent string
+		Name        string
+		Status      int64
+		Error       bool
+	}
+	testCases := []testCase{
+		{"continues the trace", "/sample/1", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "GET /sample/{sampleId}", 200, false},
+		{"new trace", "/sample/1?fail=1", "", "GET /sample/{sampleId}", 500, true},
+		{"unmatched", "/unknown", "", "GET", 404, false},
+	}
+
+	for _, tc := range testCases {
+		exp.Reset()
+		req := httptest.NewRequest(http.MethodGet, tc.Path, nil)
+		if tc.TraceParent != "" {
+			req.Header.Set("traceparent", tc.TraceParent)
+		}
+		r.ServeHTTP(httptest.NewRecorder(), req)
+
+		spans := exp.GetSpans()
+		server := spans[len(spans)-1]
+		if server.Name != tc.Name {
+			t.Errorf("%s: test failed, got: %v, want: %v", tc.Scenario, server.Name, tc.Name)
+		}
+		if server.SpanKind != trace.SpanKindServer {
+			t.Errorf("%s: test failed, got: %v, want: %v", tc.Scenario, server.SpanKind, trace.SpanKindServer)
+		}
+		if tc.TraceParent != "" {
+			if got := server.SpanContext.TraceID().String(); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+				t.Errorf("%s: test failed, got: %v, want the trace of traceparent", tc.Scenario, got)
+			}
+			if got := server.Parent.SpanID().String(); got != "00f067aa0ba902b7" {
+				t.Errorf("%s: test failed, got: %v, want the parent of traceparent", tc.Scenario, got)
+			}
+		} else if server.Parent.IsValid() {
+			t.Errorf("%s: test failed, got: %v, want no parent", tc.Scenario, server.Parent)
+		}
+		if len(spans) == 2 && spans[0].Parent.SpanID() != server.SpanContext.SpanID() {
+			t.Errorf("%s: test failed, the span of the handler is not a child of the server span", tc.Scenario)
+		}
+
+		var status int64
+		for _, kv := range server.Attributes {
+			if kv.Key == semconv.HTTPResponseStatusCodeKey {
+				status = kv.Value.AsInt64()
+			}
+		}
+		if status != tc.Status {
+			t.Errorf("%s: test failed, got: %v, want: %v", tc.Scenario, status, tc.Status)
+		}
+		if got := server.Status.Code == codes.Error; got != tc.Error {
+			t.Errorf("%s: test failed, got error: %v, want: %v", tc.Scenario, got, tc.Error)
+		}
+	}
+}
+
+func TestPurgeCacheTagsLinkedSpan(t *testing.T) {
+	exp := newTestTracer()
+	h, _ := newTestHandler(t)
+
+	ctx, request := otel.Tracer("test").Start(context.Background(), "request")
+	request.End()
+	// the request is over when the purge runs
+	h.purgeCacheTags(detachContext(ctx), sampleListTag)
+
+	var purge *tracetest.SpanStub
+	spans := exp.GetSpans()
+	for i := range spans {
+		if spans[i].Name == "purgeCacheTags" {
+			purge = &spans[i]
+		}
+	}
+	if purge == nil {
+		t.Fatalf("test failed, got: %v, want: purgeCacheTags", spans.Snapshots())
+	}
+	if purge.Parent.IsValid() {
+		t.Errorf("test failed, got: %v, want a root span", purge.Parent)
+	}
+	if len(purge.Links) != 1 || purge.Links[0].SpanContext.SpanID() != request.SpanContext().SpanID() {
+		t.Errorf("test failed, got: %v, want a link to the request", purge.Links)
+	}
+}
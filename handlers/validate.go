@@ -0,0 +1,404 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/go-chi/render"
+)
+
+// bindRequest decodes the body of r into v strictly and validates it by its `validate` tags, see DecodeRequest.
+// Then the Bind method of v only has to check what the tags can't express.
+// render.Bind is not used, since it decodes with the package variable render.Decode which is shared with the process.
+func bindRequest(r *http.Request, v render.Binder) error {
+	if err := DecodeRequest(r, v); err != nil {
+		return err
+	}
+	return v.Bind(r)
+}
+
+// maxRequestBodyBytes is the maximum size of a request body, except the bulk requests
+const maxRequestBodyBytes = 1 << 20
+
+// DecodeRequest decodes the body by Content-Type, see codecs, and responds 415 for the other types.
+// JSON bodies are rejected when they have unknown fields or trailing data, MessagePack and CBOR are decoded
+// as if they were JSON, and XML by the xml tags. Then the decoded value is validated, see validateStruct.
+func DecodeRequest(r *http.Request, v interface{}) error {
+	c := requestCodec(r)
+	if c == nil {
+		return newError(http.StatusUnsupportedMediaType, statusCode(http.StatusUnsupportedMediaType), "unsupported Content-Type: "+r.Header.Get("Content-Type"), nil)
+	}
+
+	// the codecs read the whole body before decoding it. There is no ResponseWriter to close the connection,
+	// the server drains or closes it after the response as usual.
+	return c.decode(http.MaxBytesReader(nil, r.Body, maxRequestBodyBytes), v)
+}
+
+// decodeJSON decodes exactly one JSON value without unknown fields from body and validates it
+func decodeJSON(body io.Reader, v interface{}) error {
+	dec := json.NewDecoder(body)
+	var data json.RawMessage
+	if err := dec.Decode(&data); err != nil {
+		return err
+	}
+	if err := dec.Decode(&json.RawMessage{}); err != io.EOF {
+		return newError(http.StatusBadRequest, CodeInvalidBody, "unexpected data after the JSON value", err)
+	}
+
+	if fields := unknownFields(data, reflect.TypeOf(v), ""); len(fields) > 0 {
+		return validationError(fields...)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return err
+	}
+
+	return validateStruct(v)
+}
+
+var jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+// unknownFields returns the members of the JSON value data which no field of the type t decodes,
+// the members of the nested objects included. The members are matched with the fields as encoding/json does,
+// an exact match is preferred over a case-insensitive one.
+func unknownFields(data json.RawMessage, t reflect.Type, path string) []*FieldError {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	// the type decodes itself, e.g. time.Time
+	if reflect.PtrTo(t).Implements(jsonUnmarshalerType) {
+		return nil
+	}
+
+	res := []*FieldError{}
+	switch t.Kind() {
+	case reflect.Struct:
+		// the other JSON types are reported by encoding/json as a wrong type
+		members := map[string]json.RawMessage{}
+		if err := json.Unmarshal(data, &members); err != nil {
+			return nil
+		}
+		names := make([]string, 0, len(members))
+		for name := range members {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		fields := jsonFields(t)
+		for _, name := range names {
+			fpath := name
+			if path != "" {
+				fpath = path + "." + name
+			}
+			ft, ok := fields[name]
+			for fname, ftype := range fields {
+				if !ok && strings.EqualFold(fname, name) {
+					ft, ok = ftype, true
+				}
+			}
+			if !ok {
+				res = append(res, &FieldError{Field: fpath, Code: "unknown", Message: "unknown field"})
+				continue
+			}
+			res = append(res, unknownFields(members[name], ft, fpath)...)
+		}
+	case reflect.Slice, reflect.Array:
+		items := []json.RawMessage{}
+		if err := json.Unmarshal(data, &items); err != nil {
+			return nil
+		}
+		for i, item := range items {
+			res = append(res, unknownFields(item, t.Elem(), fmt.Sprintf("%s[%d]", path, i))...)
+		}
+	}
+
+	return res
+}
+
+// jsonFields returns the types of the fields of the struct t by their JSON names,
+// the fields of embedded structs are promoted as encoding/json does
+func jsonFields(t reflect.Type) map[string]reflect.Type {
+	fields := map[string]reflect.Type{}
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		name := strings.Split(sf.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+
+		ft := sf.Type
+		for ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if sf.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			for n, typ := range jsonFields(ft) {
+				if _, ok := fields[n]; !ok {
+					fields[n] = typ
+				}
+			}
+			continue
+		}
+		if sf.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		fields[name] = sf.Type
+	}
+
+	return fields
+}
+
+// validateStruct checks every field of the struct v against the rules in its `validate` tag,
+// and reports all the failures at once with the JSON path of each field, e.g. items[0].name.
+// The rules are separated by commas:
+//
+//	required     the value must not be the zero value
+//	omitempty    the other rules are skipped for the zero value
+//	min=N, max=N bounds of a number
+//	len=N, minlen=N, maxlen=N  the number of characters of a string or the number of elements
+//	enum=a|b|c   one of the values
+//	regex=EXPR   the string matches EXPR. It has to be the last rule, since EXPR may contain commas.
+//
+// Nested structs, pointers to structs and slices of them are validated as well.
+func validateStruct(v interface{}) error {
+	fields := []*FieldError{}
+	validateValue(reflect.ValueOf(v), "", &fields)
+	if len(fields) > 0 {
+		return validationError(fields...)
+	}
+	return nil
+}
+
+func validateValue(v reflect.Value, path string, errs *[]*FieldError) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		for _, f := range structRules(v.Type()) {
+			fv := v.Field(f.index)
+			fpath := f.name
+			if path != "" {
+				fpath = path + "." + f.name
+			}
+			// the rules check the value a pointer refers to, an absent one is only checked by required
+			rv := fv
+			for rv.Kind() == reflect.Ptr && !rv.IsNil() {
+				rv = rv.Elem()
+			}
+			for _, rule := range f.rules {
+				if rv.Kind() == reflect.Ptr && rule.name != "required" {
+					continue
+				}
+				if msg := rule.check(rv); msg != "" {
+					*errs = append(*errs, &FieldError{Field: fpath, Code: rule.name, Message: msg})
+					break
+				}
+				if rule.name == "omitempty" && fv.IsZero() {
+					break
+				}
+			}
+			validateValue(fv, fpath, errs)
+		}
+	case reflect.Slice, reflect.Array:
+		elem := v.Type().Elem()
+		for elem.Kind() == reflect.Ptr {
+			elem = elem.Elem()
+		}
+		if elem.Kind() != reflect.Struct {
+			return
+		}
+		for i := 0; i < v.Len(); i++ {
+			validateValue(v.Index(i), fmt.Sprintf("%s[%d]", path, i), errs)
+		}
+	}
+}
+
+// fieldRules is the rules of a struct field, name is the JSON name
+type fieldRules struct {
+	index int
+	name  string
+	rules []*rule
+}
+
+// rule checks a value, it returns the message of the failure or an empty string
+type rule struct {
+	name  string
+	check func(v reflect.Value) string
+}
+
+// rulesCache is the parsed rules by struct type
+var rulesCache sync.Map
+
+// structRules returns the rules of the exported fields of t, tags are parsed once per type.
+// It panics on an invalid tag, which is a programming error.
+func structRules(t reflect.Type) []*fieldRules {
+	if cached, ok := rulesCache.Load(t); ok {
+		return cached.([]*fieldRules)
+	}
+
+	res := []*fieldRules{}
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" {
+			continue
+		}
+		name := strings.Split(sf.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+
+		rules, err := parseRules(sf.Tag.Get("validate"))
+		if err != nil {
+			panic(fmt.Sprintf("invalid validate tag of %s.%s: %s", t.Name(), sf.Name, err))
+		}
+		res = append(res, &fieldRules{index: i, name: name, rules: rules})
+	}
+
+	rulesCache.Store(t, res)
+	return res
+}
+
+func parseRules(tag string) ([]*rule, error) {
+	rules := []*rule{}
+	for tag != "" {
+		var part string
+		if strings.HasPrefix(tag, "regex=") {
+			part, tag = tag, ""
+		} else if i := strings.Index(tag, ","); i >= 0 {
+			part, tag = tag[:i], tag[i+1:]
+		} else {
+			part, tag = tag, ""
+		}
+
+		name, arg := part, ""
+		if i := strings.Index(part, "="); i >= 0 {
+			name, arg = part[:i], part[i+1:]
+		}
+		r, err := newRule(name, arg)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, r)
+	}
+
+	return rules, nil
+}
+
+func newRule(name string, arg string) (*rule, error) {
+	r := &rule{name: name}
+	switch name {
+	case "required":
+		r.check = func(v reflect.Value) string {
+			if v.IsZero() {
+				return "missing required field"
+			}
+			return ""
+		}
+	case "omitempty":
+		r.check = func(v reflect.Value) string { return "" }
+	case "min", "max":
+		bound, err := strconv.ParseFloat(arg, 64)
+		if err != nil {
+			return nil, err
+		}
+		r.check = func(v reflect.Value) string {
+			n, ok := number(v)
+			if !ok {
+				return ""
+			}
+			if name == "min" && n < bound {
+				return fmt.Sprintf("must be greater than or equal to %s", arg)
+			}
+			if name == "max" && n > bound {
+				return fmt.Sprintf("must be less than or equal to %s", arg)
+			}
+			return ""
+		}
+	case "len", "minlen", "maxlen":
+		bound, err := strconv.Atoi(arg)
+		if err != nil {
+			return nil, err
+		}
+		r.check = func(v reflect.Value) string {
+			n, ok := length(v)
+			switch {
+			case !ok:
+				return ""
+			case name == "len" && n != bound:
+				return fmt.Sprintf("must have exactly %d characters or elements", bound)
+			case name == "minlen" && n < bound:
+				return fmt.Sprintf("must have at least %d characters or elements", bound)
+			case name == "maxlen" && n > bound:
+				return fmt.Sprintf("must have at most %d characters or elements", bound)
+			}
+			return ""
+		}
+	case "enum":
+		values := strings.Split(arg, "|")
+		r.check = func(v reflect.Value) string {
+			s := fmt.Sprint(v.Interface())
+			for _, e := range values {
+				if s == e {
+					return ""
+				}
+			}
+			return fmt.Sprintf("must be one of %s", strings.Join(values, ", "))
+		}
+	case "regex":
+		re, err := regexp.Compile(arg)
+		if err != nil {
+			return nil, err
+		}
+		r.check = func(v reflect.Value) string {
+			if v.Kind() == reflect.String && !re.MatchString(v.String()) {
+				return fmt.Sprintf("must match %s", arg)
+			}
+			return ""
+		}
+	default:
+		return nil, errors.New("unknown rule: " + name)
+	}
+
+	return r, nil
+}
+
+func number(v reflect.Value) (float64, bool) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	}
+	return 0, false
+}
+
+func length(v reflect.Value) (int, bool) {
+	switch v.Kind() {
+	case reflect.String:
+		return utf8.RuneCountInString(v.String()), true
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return v.Len(), true
+	}
+	return 0, false
+}
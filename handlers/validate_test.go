@@ -0,0 +1,133 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/render"
+)
+
+type testValidateItem struct {
+	Name string `json:"name" validate:"required,regex=^[a-z]{1,3}$"`
+}
+
+type testValidateRequest struct {
+	Kind  string              `json:"kind" validate:"enum=a|b"`
+	Code  string              `json:"code" validate:"omitempty,len=2"`
+	Count int64               `json:"count" validate:"min=1,max=10"`
+	Items []*testValidateItem `json:"items" validate:"maxlen=2"`
+	Limit *int64              `json:"limit" validate:"min=0"`
+}
+
+func TestValidateStruct(t *testing.T) {
+	type testCase struct {
+		Scenario string
+		Value    *testValidateRequest
+		Expected []string
+	}
+	testCases := []testCase{
+		{"valid", &testValidateRequest{Kind: "a", Count: 1, Items: []*testValidateItem{{Name: "abc"}}}, nil},
+		{"every failure is reported", &testValidateRequest{Kind: "c", Code: "x", Count: 11}, []string{"kind:enum", "code:len", "count:max"}},
+		{"nested fields", &testValidateRequest{Kind: "b", Count: 1, Items: []*testValidateItem{{Name: "abc"}, {Name: ""}, {Name: "abcd"}}}, []string{"items:maxlen", "items[1].name:required", "items[2].name:regex"}},
+		{"pointer to a valid value", &testValidateRequest{Kind: "a", Count: 1, Limit: new(int64)}, nil},
+		{"pointer to an invalid value", &testValidateRequest{Kind: "a", Count: 1, Limit: func() *int64 { n := int64(-1); return &n }()}, []string{"limit:min"}},
+	}
+
+	for _, tc := range testCases {
+		var got []string
+		err := validateStruct(tc.Value)
+		var e *Error
+		if errors.As(err, &e) {
+			for _, f := range e.Fields {
+				got = append(got, f.Field+":"+f.Code)
+			}
+		}
+		if !reflect.DeepEqual(got, tc.Expected) {
+			t.Errorf("%s: test failed, got: %v, want: %v", tc.Scenario, got, tc.Expected)
+		}
+	}
+}
+
+func TestDecodeRequest(t *testing.T) {
+	type testCase struct {
+		Scenario string
+		Body     string
+		Code     ErrorCode
+		Field    string
+	}
+	testCases := []testCase{
+		{"valid", `{"foo": "a", "int_val": 1}`, "", ""},
+		{"missing field", `{"int_val": 1}`, CodeValidationFailed, "foo"},
+		{"unknown field", `{"foo": "a", "bar": 1}`, CodeValidationFailed, "bar"},
+		{"trailing data", `{"foo": "a"} {"foo": "b"}`, CodeInvalidBody, ""},
+		{"out of range", `{"foo": "a", "int_val": 2147483648}`, CodeValidationFailed, "int_val"},
+	}
+
+	for _, tc := range testCases {
+		r := httptest.NewRequest(http.MethodPost, "/sample", strings.NewReader(tc.Body))
+		r.Header.Set("Content-Type", "application/json")
+		err := bindRequest(r, &SamplePostRequest{})
+		if tc.Code == "" {
+			if err != nil {
+				t.Errorf("%s: expected non error, but some error occurred, %s", tc.Scenario, err.Error())
+			}
+			continue
+		}
+
+		e := bindError(err)
+		if e.Code != tc.Code {
+			t.Errorf("%s: test failed, got: %v, want: %v", tc.Scenario, e.Code, tc.Code)
+		}
+		if tc.Field != "" && (len(e.Fields) != 1 || e.Fields[0].Field != tc.Field) {
+			t.Errorf("%s: test failed, got: %v, want: %v", tc.Scenario, e.Fields, tc.Field)
+		}
+	}
+}
+
+func TestRenderDecodeUntouched(t *testing.T) {
+	// the other users of go-chi/render in the process keep its default decoder
+	if reflect.ValueOf(render.Decode).Pointer() != reflect.ValueOf(render.DefaultDecoder).Pointer() {
+		t.Errorf("test failed, render.Decode is replaced")
+	}
+}
+
+func TestUnknownFields(t *testing.T) {
+	type embedded struct {
+		Note string `json:"note"`
+	}
+	type request struct {
+		embedded
+		Name    string              `json:"name"`
+		Ignored string              `json:"-"`
+		Items   []*testValidateItem `json:"items"`
+		Item    testValidateItem    `json:"item"`
+	}
+
+	type testCase struct {
+		Scenario string
+		Body     string
+		Expected []string
+	}
+	testCases := []testCase{
+		{"known fields", `{"name": "a", "note": "b", "items": [{"name": "c"}], "item": {"name": "d"}}`, nil},
+		{"case-insensitive match", `{"NAME": "a"}`, nil},
+		{"unknown fields are sorted", `{"name": "a", "z": 1, "b": 2}`, []string{"b", "z"}},
+		{"ignored field", `{"Ignored": "a", "-": "b"}`, []string{"-", "Ignored"}},
+		{"nested fields", `{"items": [{"name": "a"}, {"age": 1}], "item": {"age": 2}}`, []string{"item.age", "items[1].age"}},
+		{"wrong type is left to encoding/json", `{"items": {"name": "a"}}`, nil},
+	}
+
+	for _, tc := range testCases {
+		var got []string
+		for _, f := range unknownFields([]byte(tc.Body), reflect.TypeOf(&request{}), "") {
+			got = append(got, f.Field)
+		}
+		if !reflect.DeepEqual(got, tc.Expected) {
+			t.Errorf("%s: test failed, got: %v, want: %v", tc.Scenario, got, tc.Expected)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// XML is mapped by the xml tags of the types, which have the same names as JSON.
+// The root element of a response is <response>, and the elements of an array are <item>, e.g.
+//
+//	<response><data><item><id>1</id></item></data><total>1</total></response>
+//
+// The root element of a request body can have any name.
+
+const xmlRootElement = "response"
+
+// encodeXML encodes v by the xml tags of its fields, the types which encoding/xml doesn't support,
+// e.g. maps, are not encodable
+func encodeXML(w io.Writer, v interface{}) error {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	enc := xml.NewEncoder(&buf)
+	err := enc.EncodeElement(v, xml.StartElement{Name: xml.Name{Local: xmlRootElement}})
+	var unsupported *xml.UnsupportedTypeError
+	if errors.As(err, &unsupported) {
+		return errNotEncodable
+	}
+	if err != nil {
+		return err
+	}
+	if err := enc.Flush(); err != nil {
+		return err
+	}
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+// decodeXML decodes an XML request body into v by the xml tags of its fields, and validates it.
+// The elements which no field is mapped to are rejected as unknown fields.
+func decodeXML(body io.Reader, v interface{}) error {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+
+	if err := xml.Unmarshal(data, v); err != nil {
+		return newError(http.StatusBadRequest, CodeInvalidBody, "the body is not valid XML: "+err.Error(), err)
+	}
+	if fields := xmlUnknownElements(data, reflect.TypeOf(v)); len(fields) > 0 {
+		return validationError(fields...)
+	}
+
+	return validateStruct(v)
+}
+
+// xmlUnknownElements returns the children of the root element which no field of the struct t is mapped to.
+// The deeper elements are not checked, the request bodies have no nested elements.
+func xmlUnknownElements(data []byte, t reflect.Type) []*FieldError {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	names := map[string]bool{}
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		name := strings.Split(sf.Tag.Get("xml"), ",")[0]
+		if name == "-" || sf.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		// e.g. data>item
+		names[strings.Split(name, ">")[0]] = true
+	}
+
+	res := []*FieldError{}
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	depth := 0
+	for {
+		// the syntax errors are reported by xml.Unmarshal
+		tok, err := dec.Token()
+		if err != nil {
+			return res
+		}
+		switch e := tok.(type) {
+		case xml.StartElement:
+			depth++
+			if depth == 2 && !names[e.Name.Local] {
+				res = append(res, &FieldError{Field: e.Name.Local, Code: "unknown", Message: "unknown field"})
+			}
+		case xml.EndElement:
+			depth--
+			if depth == 0 {
+				return res
+			}
+		}
+	}
+}
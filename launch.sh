@@ -4,5 +4,6 @@ export PORT="8080"
 
 export MYSQL_URL="root:@tcp(127.0.0.1:3306)/go-restapi-sample"
 export REDIS_URL="127.0.0.1:6379"
+export AUTO_MIGRATE="true"
 
-go run ./main.go
\ No newline at end of file
+go run .
\ No newline at end of file
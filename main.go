@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"io"
 	"net/http"
 	"os"
 	"os/signal"
@@ -9,11 +10,14 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/sunao-uehara/go-restapi-sample/analytics"
 	cmn "github.com/sunao-uehara/go-restapi-sample/common"
 	handler "github.com/sunao-uehara/go-restapi-sample/handlers"
 	r "github.com/sunao-uehara/go-restapi-sample/router"
+	"github.com/sunao-uehara/go-restapi-sample/storages/lru"
 	"github.com/sunao-uehara/go-restapi-sample/storages/mysql"
 	"github.com/sunao-uehara/go-restapi-sample/storages/redis"
+	"github.com/sunao-uehara/go-restapi-sample/tracing"
 	"go.uber.org/zap"
 )
 
@@ -30,24 +34,87 @@ func main() {
 	// initialize WaitGroup
 	wg := &sync.WaitGroup{}
 
+	// initialize tracing before the clients, so that their spans are exported
+	shutdownTracing, err := tracing.Setup(context.Background(), os.Getenv(cmn.TRACING_EXPORTER), "go-restapi-sample")
+	if err != nil {
+		log.Fatal("unable to initialize tracing", err)
+	}
+
 	// initialize mysql
+	if v := os.Getenv(cmn.MYSQL_QUERY_TIMEOUT); v != "" {
+		timeout, err := time.ParseDuration(v)
+		if err != nil {
+			log.Fatal("invalid MYSQL_QUERY_TIMEOUT", err)
+		}
+		mysql.DefaultQueryTimeout = timeout
+	}
 	sqldbConn, err := mysql.Initialize(os.Getenv(cmn.MYSQL_URL))
 	if err != nil {
 		log.Fatal("unable to initialize mysql", err)
 	}
 	defer sqldbConn.Close()
 
+	migrator, err := mysql.NewMigrator(sqldbConn)
+	if err != nil {
+		log.Fatal("unable to load migrations", err)
+	}
+	// run the subcommand instead of the server, e.g. `migrate up`
+	if len(os.Args) > 1 {
+		if os.Args[1] != "migrate" {
+			log.Fatalf("unknown command: %s", os.Args[1])
+		}
+		if err := runMigrate(context.Background(), migrator, os.Args[2:], os.Stdout); err != nil {
+			log.Fatal("migration failed: ", err)
+		}
+		return
+	}
+	if os.Getenv(cmn.AUTO_MIGRATE) == "true" {
+		log.Info("apply pending migrations")
+		if err := migrator.Up(context.Background()); err != nil {
+			log.Fatal("migration failed: ", err)
+		}
+	}
+
 	// initialize redis
 	redisClient := redis.Initialize(os.Getenv(cmn.REDIS_URL))
 
+	// initialize analytics
+	var pipeline *analytics.Pipeline
+	var sink analytics.Sink
+	if spec := os.Getenv(cmn.ANALYTICS_SINK); spec != "" {
+		sink, err = analytics.NewSink(spec, os.Getenv(cmn.ANALYTICS_INDEX))
+		if err != nil {
+			log.Fatal("unable to initialize analytics", err)
+		}
+		pipeline = analytics.NewPipeline(sink, &analytics.Options{
+			OnError: func(err error, events int) {
+				log.Warnf("%d analytics events are lost, %s", events, err.Error())
+			},
+		})
+	}
+
 	// initialize handler
 	h := handler.NewHandler(&handler.HandlerOptions{
-		Log:   log,
-		Wg:    wg,
-		Mysql: sqldbConn,
-		Redis: redisClient,
+		Log:        log,
+		Wg:         wg,
+		Mysql:      sqldbConn,
+		Redis:      redisClient,
+		LocalCache: lru.New(1000, 32<<20),
+		Analytics:  pipeline,
 	})
 
+	// keep the in-process cache in sync with the other instances
+	subCtx, cancelSub := context.WithCancel(context.Background())
+	defer cancelSub()
+	if err := h.SubscribeCachePurge(subCtx); err != nil {
+		log.Fatal("unable to subscribe cache purge", err)
+	}
+
+	// the events are flushed after the server is shut down
+	analyticsCtx, cancelAnalytics := context.WithCancel(context.Background())
+	defer cancelAnalytics()
+	h.StartAnalytics(analyticsCtx)
+
 	srv := &http.Server{
 		Addr:    ":" + os.Getenv(cmn.PORT),
 		Handler: r.NewRouter(h),
@@ -74,7 +141,18 @@ func main() {
 		log.Fatalf("could not gracefully shut down server, %s", err.Error())
 	}
 
+	cancelSub()
+	cancelAnalytics()
 	log.Info("waiting all goroutines are finished...")
 	wg.Wait()
+	// the analytics pipeline has drained, nothing is written to the sink anymore
+	if c, ok := sink.(io.Closer); ok {
+		if err := c.Close(); err != nil {
+			log.Warnf("could not close the analytics sink, %s", err.Error())
+		}
+	}
+	if err := shutdownTracing(ctxTimeout); err != nil {
+		log.Warnf("could not flush the spans, %s", err.Error())
+	}
 	log.Info("all done, really closing")
 }
@@ -4,7 +4,6 @@ import (
 	"net/http"
 
 	chi "github.com/go-chi/chi/v5"
-	"github.com/go-chi/render"
 
 	handler "github.com/sunao-uehara/go-restapi-sample/handlers"
 )
@@ -13,25 +12,44 @@ import (
 // returns registered handlers
 func NewRouter(h *handler.Handler) http.Handler {
 	r := chi.NewRouter()
-	r.Use(render.SetContentType(render.ContentTypeJSON))
-
-	r.Get("/", h.IndexHandler)
-
-	// /sample
-	r.Route("/sample", func(r chi.Router) {
-		r.Post("/", h.SamplePostHandler)
-		r.Get("/", h.CacheMiddleware(h.SampleGetHandler))
-		r.Get("/{sampleId}", h.CacheMiddleware(h.SampleGetHandler))
-		r.Patch("/{sampleId}", h.SamplePatchHandler)
-		// r.Put("/{sampleId}", h.SamplePostHandler)
-		// r.Delete("/{sampleId}", h.SamplePostHandler)
-	})
-
-	r.Route("/api/players", func(r chi.Router) {
-		r.Get("/", h.StatsMiddleware(h.PlayersGetHandler))
-		r.Get("/{playerId}", h.PlayersGetHandler)
-		// r.Get("/", h.CacheMiddleware(h.SampleGetHandler))
-		// r.Get("/{playerId}", h.CacheMiddleware(h.SampleGetHandler))
+	r.Use(h.RequestIDMiddleware)
+	r.Use(h.TracingMiddleware)
+	r.Use(h.AccessLogMiddleware)
+	r.Use(h.StatsMiddleware)
+	r.Use(h.RecoverMiddleware)
+	r.Use(h.GuardMiddleware)
+	// the metrics are in the Prometheus format whatever Accept is
+	r.Get("/metrics", h.MetricsHandler)
+
+	r.Group(func(r chi.Router) {
+		r.Use(h.NegotiateMiddleware)
+
+		r.Get("/", h.IndexHandler)
+
+		// /sample
+		r.Route("/sample", func(r chi.Router) {
+			r.Post("/", h.IdempotencyMiddleware(h.SamplePostHandler))
+			r.Post("/_bulk", h.IdempotencyMiddleware(h.SampleBulkHandler))
+			r.Get("/", h.CacheMiddleware(h.SampleGetHandler))
+
+			r.With(h.PathParams(map[string]*handler.ParamParser{"sampleId": handler.PositiveInt64})).Route("/{sampleId}", func(r chi.Router) {
+				r.Get("/", h.CacheMiddleware(h.SampleGetHandler))
+				r.Patch("/", h.SamplePatchHandler)
+				r.Put("/", h.SamplePutHandler)
+				r.Delete("/", h.SampleDeleteHandler)
+			})
+		})
+
+		r.Route("/api/players", func(r chi.Router) {
+			r.Post("/", h.IdempotencyMiddleware(h.PlayersPostHandler))
+			r.Get("/", h.CacheMiddleware(h.PlayersGetHandler))
+
+			r.With(h.PathParams(map[string]*handler.ParamParser{"playerId": handler.PositiveInt64})).Route("/{playerId}", func(r chi.Router) {
+				r.Get("/", h.CacheMiddleware(h.PlayersGetHandler))
+				r.Patch("/", h.PlayersPatchHandler)
+				r.Delete("/", h.PlayersDeleteHandler)
+			})
+		})
 	})
 	// route not exits
 
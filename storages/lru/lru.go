@@ -0,0 +1,107 @@
+package lru
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// Cache is an in-memory LRU cache bounded by the number of entries and the total size
+// of keys and values. Every entry has its own TTL. It's safe for concurrent use.
+type Cache struct {
+	mu         sync.Mutex
+	maxEntries int
+	maxBytes   int
+	bytes      int
+	ll         *list.List
+	items      map[string]*list.Element
+
+	// now is replaceable for testing
+	now func() time.Time
+}
+
+type entry struct {
+	key       string
+	value     string
+	expiresAt time.Time
+}
+
+func (e *entry) size() int {
+	return len(e.key) + len(e.value)
+}
+
+// New returns a Cache, zero maxEntries or maxBytes means no limit for it
+func New(maxEntries, maxBytes int) *Cache {
+	return &Cache{
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		ll:         list.New(),
+		items:      map[string]*list.Element{},
+		now:        time.Now,
+	}
+}
+
+// Get returns the value of key, expired entries are removed and reported as missing
+func (c *Cache) Get(key string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[key]
+	if !ok {
+		return "", false
+	}
+	e := el.Value.(*entry)
+	if !c.now().Before(e.expiresAt) {
+		c.removeElement(el)
+		return "", false
+	}
+
+	c.ll.MoveToFront(el)
+	return e.value, true
+}
+
+// Set stores value for ttl, evicting the least recently used entries if the cache is full.
+// A value larger than maxBytes is not stored at all.
+func (c *Cache) Set(key, value string, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[key]; ok {
+		c.removeElement(el)
+	}
+
+	e := &entry{key: key, value: value, expiresAt: c.now().Add(ttl)}
+	if c.maxBytes > 0 && e.size() > c.maxBytes {
+		return
+	}
+	c.items[key] = c.ll.PushFront(e)
+	c.bytes += e.size()
+
+	for (c.maxEntries > 0 && c.ll.Len() > c.maxEntries) || (c.maxBytes > 0 && c.bytes > c.maxBytes) {
+		c.removeElement(c.ll.Back())
+	}
+}
+
+// Delete removes key
+func (c *Cache) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[key]; ok {
+		c.removeElement(el)
+	}
+}
+
+// Len returns the number of entries, including expired ones which are not removed yet
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.ll.Len()
+}
+
+func (c *Cache) removeElement(el *list.Element) {
+	e := c.ll.Remove(el).(*entry)
+	delete(c.items, e.key)
+	c.bytes -= e.size()
+}
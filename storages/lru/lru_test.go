@@ -0,0 +1,59 @@
+package lru
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCacheEviction(t *testing.T) {
+	c := New(2, 0)
+	c.Set("a", "1", time.Minute)
+	c.Set("b", "2", time.Minute)
+	// a is the most recently used now
+	c.Get("a")
+	c.Set("c", "3", time.Minute)
+
+	if _, ok := c.Get("b"); ok {
+		t.Errorf("test failed, b should be evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok := c.Get(key); !ok {
+			t.Errorf("test failed, %s should be kept", key)
+		}
+	}
+}
+
+func TestCacheMaxBytes(t *testing.T) {
+	c := New(0, 10)
+	c.Set("a", "12345", time.Minute)
+	c.Set("b", "12345", time.Minute)
+	if c.Len() != 1 {
+		t.Errorf("test failed, got: %v entries, want: 1", c.Len())
+	}
+	if _, ok := c.Get("b"); !ok {
+		t.Errorf("test failed, b should be kept")
+	}
+
+	// too large to be stored at all
+	c.Set("c", "12345678901", time.Minute)
+	if _, ok := c.Get("c"); ok {
+		t.Errorf("test failed, c should not be stored")
+	}
+}
+
+func TestCacheTTL(t *testing.T) {
+	now := time.Now()
+	c := New(0, 0)
+	c.now = func() time.Time { return now }
+
+	c.Set("a", "1", time.Second)
+	c.Set("b", "2", time.Minute)
+	now = now.Add(2 * time.Second)
+
+	if _, ok := c.Get("a"); ok {
+		t.Errorf("test failed, a should be expired")
+	}
+	if v, ok := c.Get("b"); !ok || v != "2" {
+		t.Errorf("test failed, got: %v, want: 2", v)
+	}
+}
@@ -0,0 +1,291 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// the kinds of BulkOperation
+const (
+	BulkCreate = "create"
+	BulkUpdate = "update"
+	BulkDelete = "delete"
+)
+
+// bulkInsertRows is the maximum number of rows of a multi-row INSERT
+const bulkInsertRows = 100
+
+// ErrNotFound is returned when the record to update or delete doesn't exist
+var ErrNotFound = errors.New("not found")
+
+// ErrRolledBack is the result of the operations which succeeded but were not committed,
+// since another operation of an atomic bulk failed
+var ErrRolledBack = errors.New("rolled back")
+
+// BulkOperation is an operation of BulkSample.
+// Create uses Sample, update uses ID, Sample and Fields as UpdateSampleFields does, and delete uses ID.
+type BulkOperation struct {
+	Op     string
+	ID     int64
+	Sample *SampleData
+	Fields []string
+}
+
+// BulkResult is the result of a BulkOperation, ID is the new one for create
+type BulkResult struct {
+	ID  int64
+	Err error
+}
+
+// BulkSample runs ops in order in a single transaction, consecutive creates are inserted with multi-row INSERTs.
+// A result is returned for every operation in the same order.
+// When atomic is true nothing is committed if any operation fails, and the ones which didn't fail get ErrRolledBack.
+// Otherwise every operation which succeeded is committed. The error is returned only when the transaction fails.
+func (sc *SQLSample) BulkSample(ctx context.Context, ops []*BulkOperation, atomic bool) ([]*BulkResult, error) {
+	results := make([]*BulkResult, len(ops))
+	for i, op := range ops {
+		results[i] = &BulkResult{ID: op.ID}
+	}
+
+	tx, err := sc.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	// it's a no-op once the transaction is committed
+	defer tx.Rollback()
+
+	b := &bulkTx{tx: tx, stmts: map[string]*sql.Stmt{}}
+	defer b.close()
+
+	failed := false
+	for i := 0; i < len(ops) && !(atomic && failed); {
+		if ops[i].Op != BulkCreate {
+			err := b.savepoint(ctx, func() error {
+				return b.run(ctx, ops[i])
+			})
+			if err != nil {
+				if !isItemError(err) {
+					return nil, err
+				}
+				results[i].Err = err
+				failed = true
+			}
+			i++
+			continue
+		}
+
+		j := i + 1
+		for j < len(ops) && ops[j].Op == BulkCreate && j-i < bulkInsertRows {
+			j++
+		}
+		itemFailed, err := b.createAll(ctx, ops[i:j], results[i:j], atomic)
+		if err != nil {
+			return nil, err
+		}
+		failed = failed || itemFailed
+		i = j
+	}
+
+	if atomic && failed {
+		for _, res := range results {
+			if res.Err == nil {
+				res.Err = ErrRolledBack
+			}
+		}
+		return results, nil
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// bulkTx is the transaction of BulkSample, it prepares each distinct statement only once
+type bulkTx struct {
+	tx    *sql.Tx
+	stmts map[string]*sql.Stmt
+	// autoIncrement is @@auto_increment_increment, the step between the ids of a multi-row INSERT
+	autoIncrement int64
+}
+
+// txError is an error of the transaction itself, as opposed to an error of an operation
+type txError struct {
+	err error
+}
+
+func (e *txError) Error() string { return e.err.Error() }
+func (e *txError) Unwrap() error { return e.err }
+
+func isItemError(err error) bool {
+	var te *txError
+	return !errors.As(err, &te)
+}
+
+func (b *bulkTx) close() {
+	for _, stmt := range b.stmts {
+		stmt.Close()
+	}
+}
+
+func (b *bulkTx) exec(ctx context.Context, q string, args ...interface{}) (sql.Result, error) {
+	stmt, ok := b.stmts[q]
+	if !ok {
+		var err error
+		if stmt, err = b.tx.PrepareContext(ctx, q); err != nil {
+			return nil, err
+		}
+		b.stmts[q] = stmt
+	}
+
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+	return stmt.ExecContext(ctx, args...)
+}
+
+// savepoint runs f and undoes what it did when it fails, without aborting the transaction
+func (b *bulkTx) savepoint(ctx context.Context, f func() error) error {
+	if _, err := b.tx.ExecContext(ctx, `SAVEPOINT bulk_item`); err != nil {
+		return &txError{err}
+	}
+	if err := f(); err != nil {
+		if _, rerr := b.tx.ExecContext(ctx, `ROLLBACK TO SAVEPOINT bulk_item`); rerr != nil {
+			return &txError{rerr}
+		}
+		return err
+	}
+	if _, err := b.tx.ExecContext(ctx, `RELEASE SAVEPOINT bulk_item`); err != nil {
+		return &txError{err}
+	}
+	return nil
+}
+
+// createAll inserts ops with a single statement. When it fails, the rows are inserted one by one
+// to find out which ones are wrong. It reports whether any of them failed.
+func (b *bulkTx) createAll(ctx context.Context, ops []*BulkOperation, results []*BulkResult, atomic bool) (bool, error) {
+	for _, op := range ops {
+		if op.Sample == nil {
+			return b.createEach(ctx, ops, results, atomic)
+		}
+	}
+
+	err := b.savepoint(ctx, func() error {
+		values := make([]string, 0, len(ops))
+		args := make([]interface{}, 0, 2*len(ops))
+		for _, op := range ops {
+			values = append(values, `(?, ?)`)
+			args = append(args, op.Sample.Foo, op.Sample.IntVal)
+		}
+		q := `INSERT INTO sample (foo, int_val) VALUES ` + strings.Join(values, `, `)
+		res, err := b.exec(ctx, q, args...)
+		if err != nil {
+			return err
+		}
+		first, err := res.LastInsertId()
+		if err != nil {
+			return err
+		}
+		step, err := b.autoIncrementStep(ctx)
+		if err != nil {
+			return &txError{err}
+		}
+
+		// the ids of a multi-row INSERT are consecutive. The number of rows is known in advance,
+		// so InnoDB allocates them at once in every innodb_autoinc_lock_mode.
+		for i := range ops {
+			results[i].ID = first + int64(i)*step
+		}
+		return nil
+	})
+	if err == nil {
+		return false, nil
+	}
+	if !isItemError(err) {
+		return false, err
+	}
+
+	return b.createEach(ctx, ops, results, atomic)
+}
+
+func (b *bulkTx) createEach(ctx context.Context, ops []*BulkOperation, results []*BulkResult, atomic bool) (bool, error) {
+	failed := false
+	for i, op := range ops {
+		err := b.savepoint(ctx, func() error {
+			if op.Sample == nil {
+				return errors.New("invalid data")
+			}
+			res, err := b.exec(ctx, `INSERT INTO sample (foo, int_val) VALUES (?, ?)`, op.Sample.Foo, op.Sample.IntVal)
+			if err != nil {
+				return err
+			}
+			results[i].ID, err = res.LastInsertId()
+			return err
+		})
+		if err != nil {
+			if !isItemError(err) {
+				return false, err
+			}
+			results[i].Err = err
+			failed = true
+			if atomic {
+				break
+			}
+		}
+	}
+
+	return failed, nil
+}
+
+func (b *bulkTx) autoIncrementStep(ctx context.Context) (int64, error) {
+	if b.autoIncrement == 0 {
+		ctx, cancel := withQueryTimeout(ctx)
+		defer cancel()
+		if err := b.tx.QueryRowContext(ctx, `SELECT @@auto_increment_increment`).Scan(&b.autoIncrement); err != nil {
+			return 0, err
+		}
+	}
+	return b.autoIncrement, nil
+}
+
+// run runs an update or delete operation
+func (b *bulkTx) run(ctx context.Context, op *BulkOperation) error {
+	switch op.Op {
+	case BulkUpdate:
+		if op.Sample == nil {
+			return errors.New("invalid data")
+		}
+		q, args, err := sampleUpdateQuery(op.ID, op.Sample, op.Fields)
+		if err != nil {
+			return err
+		}
+		res, err := b.exec(ctx, q, args...)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil || n > 0 {
+			return err
+		}
+
+		// nothing changed, tell whether the record is missing or at another version
+		return unchangedSampleError(ctx, b.tx, op.ID, op.Sample.Version)
+	case BulkDelete:
+		res, err := b.exec(ctx, `DELETE FROM sample WHERE id = ?`, op.ID)
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return ErrNotFound
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown bulk operation: %s", op.Op)
+	}
+}
@@ -0,0 +1,61 @@
+package mysql
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestBulkSample(t *testing.T) {
+	truncateTestTable(t, "sample")
+	sc := NewSample(testDB)
+	sc.CreateSample(context.Background(), &SampleData{Foo: "var", IntVal: int64(100)})
+
+	ops := []*BulkOperation{
+		{Op: BulkCreate, Sample: &SampleData{Foo: "a", IntVal: 1}},
+		{Op: BulkCreate, Sample: &SampleData{Foo: "b", IntVal: 2}},
+		{Op: BulkUpdate, ID: 1, Sample: &SampleData{IntVal: 0}, Fields: []string{"int_val"}},
+		{Op: BulkDelete, ID: 99},
+		{Op: BulkCreate, Sample: &SampleData{Foo: "c", IntVal: 3}},
+	}
+
+	// the missing record makes the whole bulk fail
+	results, err := sc.BulkSample(context.Background(), ops, true)
+	if err != nil {
+		t.Fatalf("expected non error, but some error occurred, %s", err.Error())
+	}
+	wantErrs := []error{ErrRolledBack, ErrRolledBack, ErrRolledBack, ErrNotFound, ErrRolledBack}
+	for i, res := range results {
+		if !errors.Is(res.Err, wantErrs[i]) {
+			t.Errorf("test failed, got: %v, want: %v", res.Err, wantErrs[i])
+		}
+	}
+	if total, _ := sc.CountSample(context.Background(), nil); total != 1 {
+		t.Errorf("test failed, got: %v, want: 1", total)
+	}
+
+	// the other operations are committed
+	results, err = sc.BulkSample(context.Background(), ops, false)
+	if err != nil {
+		t.Fatalf("expected non error, but some error occurred, %s", err.Error())
+	}
+	wantIDs := []int64{4, 5, 1, 99, 6}
+	for i, res := range results {
+		if res.ID != wantIDs[i] {
+			t.Errorf("test failed, got: %v, want: %v", res.ID, wantIDs[i])
+		}
+		if (res.Err != nil) != (i == 3) {
+			t.Errorf("test failed, got: %v", res.Err)
+		}
+	}
+	got, err := sc.GetSample(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("expected non error, but some error occurred, %s", err.Error())
+	}
+	if got.IntVal != 0 || got.Version != 2 {
+		t.Errorf("test failed, got: %v", got)
+	}
+	if got, _ := sc.GetSample(context.Background(), 5); got == nil || got.Foo != "b" {
+		t.Errorf("test failed, got: %v", got)
+	}
+}
@@ -1,8 +1,8 @@
 package mysql
 
 import (
+	"context"
 	"database/sql"
-	"io/ioutil"
 	"log"
 	"os"
 	"testing"
@@ -10,30 +10,60 @@ import (
 
 const (
 	dbDriver = "mysql"
-	dbSource = "root:@tcp(127.0.0.1:3306)/go-restapi-sample_test"
+	dbSource = "root:@tcp(127.0.0.1:3306)/go-restapi-sample_test?parseTime=true&timeout=1s"
+
+	// migrateTestDBName is the database of TestMigrate, which reverts every migration
+	migrateTestDBName   = "go-restapi-sample_migrate_test"
+	migrateTestDBSource = "root:@tcp(127.0.0.1:3306)/" + migrateTestDBName + "?parseTime=true&timeout=1s"
 )
 
 var testDB *sql.DB
 
+// testDBAvailable is false when MySQL is not running, then the tests which need it are skipped, see launch_db.sh
+var testDBAvailable bool
+
 func TestMain(m *testing.M) {
 	db, err := sql.Open("mysql", dbSource)
 	if err != nil {
 		log.Fatal("cannot connect to db:", err)
 	}
 
+	// the tables are created by the migrations, the same as production.
+	// The tests which don't need MySQL still run without it.
+	if err := db.Ping(); err != nil {
+		log.Println("cannot connect to db:", err)
+	} else if err := migrateTestDB(db); err != nil {
+		log.Fatal("cannot migrate db:", err)
+	} else {
+		testDBAvailable = true
+	}
+
 	testDB = db
 	os.Exit(m.Run())
 }
 
-func createTestTable(table string) {
-	sql, err := ioutil.ReadFile("./schemas/" + table + ".sql")
+func migrateTestDB(db *sql.DB) error {
+	migrator, err := NewMigrator(db)
 	if err != nil {
-		panic("cannot load sql file")
+		return err
 	}
-	testDB.Exec(string(sql))
+	return migrator.Up(context.Background())
 }
 
-func deleteTestTable(table string) {
-	sql := `DROP TABLE ` + table
-	testDB.Exec(sql)
+// requireTestDB skips the test when MySQL is not available
+func requireTestDB(t *testing.T) {
+	t.Helper()
+	if !testDBAvailable {
+		t.Skip("MySQL is not available")
+	}
+}
+
+// truncateTestTable empties table, which the migrations have created.
+// The test is skipped when MySQL is not available.
+func truncateTestTable(t *testing.T, table string) {
+	t.Helper()
+	requireTestDB(t)
+	if _, err := testDB.Exec(`TRUNCATE TABLE ` + table); err != nil {
+		t.Fatalf("cannot empty %s: %s", table, err)
+	}
 }
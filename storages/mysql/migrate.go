@@ -0,0 +1,343 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed migrations/*.sql
+var embeddedMigrations embed.FS
+
+// migrationLockName is the name of the MySQL user lock which serializes migrations across instances
+const migrationLockName = "schema_migrations"
+
+var migrationFileRe = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// ErrDirtyMigration is returned when a previous migration failed in the middle.
+// DDL can't be rolled back in MySQL, so the schema has to be fixed by hand.
+var ErrDirtyMigration = errors.New("database is dirty, fix the schema and the row in schema_migrations by hand")
+
+// Migration is a numbered pair of up/down sql scripts, e.g. migrations/0002_create_players.up.sql
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus tells whether a migration has been applied
+type MigrationStatus struct {
+	Version   int64
+	Name      string
+	Applied   bool
+	Dirty     bool
+	AppliedAt time.Time
+}
+
+// Migrator applies the migrations embedded in the binary and records them in the table `schema_migrations`
+type Migrator struct {
+	db         *sql.DB
+	migrations []*Migration
+	// LockTimeout is how long to wait for another instance which is migrating
+	LockTimeout time.Duration
+}
+
+func NewMigrator(dbConn *sql.DB) (*Migrator, error) {
+	migrations, err := loadMigrations(embeddedMigrations, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{
+		db:          dbConn,
+		migrations:  migrations,
+		LockTimeout: 30 * time.Second,
+	}, nil
+}
+
+// loadMigrations reads every migration in dir of fsys, sorted by version
+func loadMigrations(fsys fs.FS, dir string) ([]*Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int64]*Migration{}
+	for _, e := range entries {
+		m := migrationFileRe.FindStringSubmatch(e.Name())
+		if m == nil {
+			return nil, fmt.Errorf("invalid migration file name: %s", e.Name())
+		}
+		version, _ := strconv.ParseInt(m[1], 10, 64)
+		b, err := fs.ReadFile(fsys, path.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = mig
+		}
+		if mig.Name != m[2] {
+			return nil, fmt.Errorf("migration %d has two names: %s, %s", version, mig.Name, m[2])
+		}
+		if m[3] == "up" {
+			mig.Up = string(b)
+		} else {
+			mig.Down = string(b)
+		}
+	}
+
+	migrations := make([]*Migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		if strings.TrimSpace(mig.Up) == "" || strings.TrimSpace(mig.Down) == "" {
+			return nil, fmt.Errorf("migration %d_%s needs both up and down scripts", mig.Version, mig.Name)
+		}
+		migrations = append(migrations, mig)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// splitStatements splits a script into statements at the semicolons ending a line,
+// since the driver doesn't run multiple statements at once by default
+func splitStatements(script string) []string {
+	stmts := []string{}
+	var cur strings.Builder
+	for _, line := range strings.Split(script, "\n") {
+		cur.WriteString(line)
+		cur.WriteString("\n")
+		if strings.HasSuffix(strings.TrimSpace(line), ";") {
+			if s := strings.TrimSpace(cur.String()); s != ";" {
+				stmts = append(stmts, s)
+			}
+			cur.Reset()
+		}
+	}
+	if s := strings.TrimSpace(cur.String()); s != "" {
+		stmts = append(stmts, s)
+	}
+
+	return stmts
+}
+
+// Latest returns the version of the newest migration
+func (m *Migrator) Latest() int64 {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Up applies every pending migration
+func (m *Migrator) Up(ctx context.Context) error {
+	return m.To(ctx, m.Latest())
+}
+
+// Down reverts the latest applied migration
+func (m *Migrator) Down(ctx context.Context) error {
+	return m.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for i := len(m.migrations) - 1; i >= 0; i-- {
+			if _, ok := applied[m.migrations[i].Version]; ok {
+				return m.down(ctx, conn, m.migrations[i])
+			}
+		}
+		return nil
+	})
+}
+
+// To applies or reverts migrations until version is the latest applied one. Zero reverts everything.
+func (m *Migrator) To(ctx context.Context, version int64) error {
+	if version != 0 && m.find(version) == nil {
+		return fmt.Errorf("unknown migration version: %d", version)
+	}
+
+	return m.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(m.migrations) - 1; i >= 0; i-- {
+			mig := m.migrations[i]
+			if _, ok := applied[mig.Version]; ok && mig.Version > version {
+				if err := m.down(ctx, conn, mig); err != nil {
+					return err
+				}
+			}
+		}
+		for _, mig := range m.migrations {
+			if _, ok := applied[mig.Version]; !ok && mig.Version <= version {
+				if err := m.up(ctx, conn, mig); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// Status returns every known migration and whether it has been applied
+func (m *Migrator) Status(ctx context.Context) ([]*MigrationStatus, error) {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if err := m.createTable(ctx, conn); err != nil {
+		return nil, err
+	}
+	applied, err := m.applied(ctx, conn)
+	if err != nil && !errors.Is(err, ErrDirtyMigration) {
+		return nil, err
+	}
+
+	res := make([]*MigrationStatus, 0, len(m.migrations))
+	for _, mig := range m.migrations {
+		st := &MigrationStatus{Version: mig.Version, Name: mig.Name}
+		if a, ok := applied[mig.Version]; ok {
+			st.Applied = true
+			st.Dirty = a.Dirty
+			st.AppliedAt = a.AppliedAt
+		}
+		res = append(res, st)
+	}
+
+	return res, nil
+}
+
+func (m *Migrator) find(version int64) *Migration {
+	for _, mig := range m.migrations {
+		if mig.Version == version {
+			return mig
+		}
+	}
+	return nil
+}
+
+// withLock runs f on a single connection holding the migration lock,
+// since MySQL user locks belong to the connection
+func (m *Migrator) withLock(ctx context.Context, f func(conn *sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var got sql.NullInt64
+	q := `SELECT GET_LOCK(?, ?)`
+	if err := conn.QueryRowContext(ctx, q, migrationLockName, int(m.LockTimeout.Seconds())).Scan(&got); err != nil {
+		return err
+	}
+	if got.Int64 != 1 {
+		return errors.New("another instance is migrating the database")
+	}
+	defer conn.ExecContext(context.Background(), `SELECT RELEASE_LOCK(?)`, migrationLockName)
+
+	if err := m.createTable(ctx, conn); err != nil {
+		return err
+	}
+
+	return f(conn)
+}
+
+func (m *Migrator) createTable(ctx context.Context, conn *sql.Conn) error {
+	q := `CREATE TABLE IF NOT EXISTS schema_migrations (
+	version bigint NOT NULL,
+	name varchar(255) NOT NULL,
+	dirty tinyint(1) NOT NULL DEFAULT 0,
+	applied_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (version)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`
+	_, err := conn.ExecContext(ctx, q)
+	return err
+}
+
+// applied returns the rows of schema_migrations by version.
+// ErrDirtyMigration is returned together with the rows when one of them is dirty.
+func (m *Migrator) applied(ctx context.Context, conn *sql.Conn) (map[int64]*MigrationStatus, error) {
+	q := `SELECT version, name, dirty, applied_at FROM schema_migrations`
+	rows, err := conn.QueryContext(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := map[int64]*MigrationStatus{}
+	var dirty error
+	for rows.Next() {
+		st := &MigrationStatus{Applied: true}
+		var appliedAt []byte
+		if err := rows.Scan(&st.Version, &st.Name, &st.Dirty, &appliedAt); err != nil {
+			return nil, err
+		}
+		st.AppliedAt = parseTimestamp(appliedAt)
+		if st.Dirty {
+			dirty = fmt.Errorf("%w: version %d", ErrDirtyMigration, st.Version)
+		}
+		res[st.Version] = st
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return res, dirty
+}
+
+func (m *Migrator) up(ctx context.Context, conn *sql.Conn, mig *Migration) error {
+	q := `INSERT INTO schema_migrations (version, name, dirty) VALUES (?, ?, 1)`
+	if _, err := conn.ExecContext(ctx, q, mig.Version, mig.Name); err != nil {
+		return err
+	}
+	for _, stmt := range splitStatements(mig.Up) {
+		if _, err := conn.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("migration %d_%s up: %w", mig.Version, mig.Name, err)
+		}
+	}
+	_, err := conn.ExecContext(ctx, `UPDATE schema_migrations SET dirty = 0 WHERE version = ?`, mig.Version)
+	return err
+}
+
+func (m *Migrator) down(ctx context.Context, conn *sql.Conn, mig *Migration) error {
+	q := `UPDATE schema_migrations SET dirty = 1 WHERE version = ?`
+	if _, err := conn.ExecContext(ctx, q, mig.Version); err != nil {
+		return err
+	}
+	for _, stmt := range splitStatements(mig.Down) {
+		if _, err := conn.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("migration %d_%s down: %w", mig.Version, mig.Name, err)
+		}
+	}
+	_, err := conn.ExecContext(ctx, `DELETE FROM schema_migrations WHERE version = ?`, mig.Version)
+	return err
+}
+
+// parseTimestamp parses a TIMESTAMP column scanned into []byte, which is
+// formatted by MySQL or, with parseTime=true in the DSN, by database/sql
+func parseTimestamp(b []byte) time.Time {
+	for _, layout := range []string{"2006-01-02 15:04:05", time.RFC3339Nano} {
+		if t, err := time.Parse(layout, string(b)); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
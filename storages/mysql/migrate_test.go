@@ -0,0 +1,120 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	migrations, err := loadMigrations(embeddedMigrations, "migrations")
+	if err != nil {
+		t.Fatalf("expected non error, but some error occurred, %s", err.Error())
+	}
+	for i, mig := range migrations {
+		if mig.Version != int64(i+1) {
+			t.Errorf("test failed, got: version %v, want: %v", mig.Version, i+1)
+		}
+	}
+
+	type testCase struct {
+		Scenario string
+		In       fstest.MapFS
+	}
+	testCases := []testCase{
+		{
+			"failure case, missing down script",
+			fstest.MapFS{
+				"migrations/0001_a.up.sql": {Data: []byte("SELECT 1;")},
+			},
+		},
+		{
+			"failure case, invalid file name",
+			fstest.MapFS{
+				"migrations/create_a.sql": {Data: []byte("SELECT 1;")},
+			},
+		},
+		{
+			"failure case, two names for one version",
+			fstest.MapFS{
+				"migrations/0001_a.up.sql":   {Data: []byte("SELECT 1;")},
+				"migrations/0001_b.down.sql": {Data: []byte("SELECT 1;")},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		if _, err := loadMigrations(tc.In, "migrations"); err == nil {
+			t.Errorf("%s: expected error, but results: no error", tc.Scenario)
+		}
+	}
+}
+
+func TestSplitStatements(t *testing.T) {
+	in := `CREATE TABLE a (
+	id int
+);
+
+ALTER TABLE a ADD COLUMN b int;
+`
+	want := []string{
+		"CREATE TABLE a (\n\tid int\n);",
+		"ALTER TABLE a ADD COLUMN b int;",
+	}
+	if got := splitStatements(in); !reflect.DeepEqual(want, got) {
+		t.Errorf("test failed, got: %q, want: %q", got, want)
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	requireTestDB(t)
+	// every migration is reverted at the end, so it runs on its own database rather than testDB
+	if _, err := testDB.Exec("DROP DATABASE IF EXISTS `" + migrateTestDBName + "`"); err != nil {
+		t.Fatalf("expected non error, but some error occurred, %s", err.Error())
+	}
+	if _, err := testDB.Exec("CREATE DATABASE `" + migrateTestDBName + "`"); err != nil {
+		t.Fatalf("expected non error, but some error occurred, %s", err.Error())
+	}
+	db, err := sql.Open(dbDriver, migrateTestDBSource)
+	if err != nil {
+		t.Fatalf("expected non error, but some error occurred, %s", err.Error())
+	}
+	t.Cleanup(func() {
+		db.Close()
+		testDB.Exec("DROP DATABASE IF EXISTS `" + migrateTestDBName + "`")
+	})
+
+	m, err := NewMigrator(db)
+	if err != nil {
+		t.Fatalf("expected non error, but some error occurred, %s", err.Error())
+	}
+	ctx := context.Background()
+
+	status, _ := m.Status(ctx)
+	for _, st := range status {
+		if st.Applied {
+			t.Errorf("test failed, migration %d should not be applied yet", st.Version)
+		}
+	}
+
+	if err := m.Up(ctx); err != nil {
+		t.Fatalf("expected non error, but some error occurred, %s", err.Error())
+	}
+	status, _ = m.Status(ctx)
+	for _, st := range status {
+		if !st.Applied || st.Dirty {
+			t.Errorf("test failed, migration %d should be applied", st.Version)
+		}
+	}
+
+	if err := m.To(ctx, 0); err != nil {
+		t.Fatalf("expected non error, but some error occurred, %s", err.Error())
+	}
+	status, _ = m.Status(ctx)
+	for _, st := range status {
+		if st.Applied {
+			t.Errorf("test failed, migration %d should be reverted", st.Version)
+		}
+	}
+}
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS players (
+	id int(11) unsigned NOT NULL AUTO_INCREMENT,
+	name varchar(255) NOT NULL,
+	level int(11) NOT NULL DEFAULT 1,
+	score int(11) NOT NULL DEFAULT 0,
+	created_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+	PRIMARY KEY (id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1 @@
+ALTER TABLE sample DROP COLUMN version;
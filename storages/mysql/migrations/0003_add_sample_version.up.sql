@@ -0,0 +1 @@
+ALTER TABLE sample ADD COLUMN version int(11) unsigned NOT NULL DEFAULT 1 AFTER int_val;
@@ -1,7 +1,9 @@
 package mysql
 
 import (
+	"context"
 	"database/sql"
+	"time"
 
 	"github.com/go-sql-driver/mysql"
 )
@@ -11,24 +13,49 @@ func Initialize(url string) (*sql.DB, error) {
 	if err != nil {
 		return nil, err
 	}
+	// scan TIMESTAMP columns into time.Time
+	sqlURL.ParseTime = true
 
-	db, err := sql.Open("mysql", sqlURL.FormatDSN())
+	connector, err := mysql.NewConnector(sqlURL)
 	if err != nil {
 		return nil, err
 	}
+	// every statement is traced, see tracingConnector
+	db := sql.OpenDB(&tracingConnector{connector})
 	// defer db.Close()
 
 	return db, nil
 }
 
-func insert(dbConn *sql.DB, sql string, args ...interface{}) (int64, error) {
-	stmt, err := dbConn.Prepare(sql)
+// DefaultQueryTimeout is the deadline of every query, unless the given context has an earlier one.
+// Zero disables it.
+var DefaultQueryTimeout = 5 * time.Second
+
+// withQueryTimeout applies DefaultQueryTimeout to ctx
+func withQueryTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if DefaultQueryTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, DefaultQueryTimeout)
+}
+
+// queryer is implemented by both *sql.DB and *sql.Tx, so that the helpers work inside a transaction
+type queryer interface {
+	PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+func insert(ctx context.Context, dbConn queryer, sql string, args ...interface{}) (int64, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	stmt, err := dbConn.PrepareContext(ctx, sql)
 	if err != nil {
 		return 0, err
 	}
 	defer stmt.Close()
 
-	res, err := stmt.Exec(args...)
+	res, err := stmt.ExecContext(ctx, args...)
 	if err != nil {
 		return 0, err
 	}
@@ -40,14 +67,17 @@ func insert(dbConn *sql.DB, sql string, args ...interface{}) (int64, error) {
 	return id, nil
 }
 
-func update(dbConn *sql.DB, sql string, args []interface{}) (int64, error) {
-	stmt, err := dbConn.Prepare(sql)
+func update(ctx context.Context, dbConn queryer, sql string, args []interface{}) (int64, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	stmt, err := dbConn.PrepareContext(ctx, sql)
 	if err != nil {
 		return 0, err
 	}
 	defer stmt.Close()
 
-	res, err := stmt.Exec(args...)
+	res, err := stmt.ExecContext(ctx, args...)
 	if err != nil {
 		return 0, err
 	}
@@ -0,0 +1,208 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	_ "github.com/go-sql-driver/mysql"
+)
+
+type Player interface {
+	CreatePlayer(ctx context.Context, player *PlayerData) (int64, error)
+	GetPlayer(ctx context.Context, id int64) (*PlayerData, error)
+	ListPlayer(ctx context.Context, opts *ListOptions) ([]*PlayerData, error)
+	CountPlayer(ctx context.Context, opts *ListOptions) (int64, error)
+	UpdatePlayer(ctx context.Context, id int64, player *PlayerData) (int64, error)
+	PatchPlayer(ctx context.Context, id int64, player *PlayerData, fields []string) (*PlayerData, error)
+	DeletePlayer(ctx context.Context, id int64) (int64, error)
+}
+
+func NewPlayer(dbConn *sql.DB) Player {
+	return &SQLPlayer{
+		db: dbConn,
+	}
+}
+
+type SQLPlayer struct {
+	db *sql.DB
+}
+
+// PlayerData is data structure that is corresponding to the table `players`
+type PlayerData struct {
+	ID    int64  `json:"id" xml:"id"`
+	Name  string `json:"name" xml:"name"`
+	Level int64  `json:"level" xml:"level"`
+	Score int64  `json:"score" xml:"score"`
+}
+
+func (sp *SQLPlayer) CreatePlayer(ctx context.Context, player *PlayerData) (int64, error) {
+	if player == nil {
+		return 0, errors.New("invalid data")
+	}
+
+	level := player.Level
+	if level == 0 {
+		level = 1
+	}
+
+	q := `INSERT INTO players (name, level, score) VALUES (?, ?, ?)`
+	id, err := insert(ctx, sp.db, q, player.Name, level, player.Score)
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+func (sp *SQLPlayer) GetPlayer(ctx context.Context, id int64) (*PlayerData, error) {
+	data := &PlayerData{}
+
+	q := `SELECT id, name, level, score FROM players WHERE id = ?`
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+	err := sp.db.QueryRowContext(ctx, q, id).Scan(&data.ID, &data.Name, &data.Level, &data.Score)
+	if err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// playerQuery is the list query builder for the table `players`, it rejects any other columns
+var playerQuery = newListQuery("players", "id", "name", "level", "score")
+
+// ListPlayer returns one page of records filtered and sorted by opts, see ListSample
+func (sp *SQLPlayer) ListPlayer(ctx context.Context, opts *ListOptions) ([]*PlayerData, error) {
+	rows, err := playerQuery.list(ctx, sp.db, opts, func(rows *sql.Rows) (interface{}, error) {
+		data := &PlayerData{}
+		err := rows.Scan(&data.ID, &data.Name, &data.Level, &data.Score)
+		return data, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]*PlayerData, 0, len(rows))
+	for _, row := range rows {
+		res = append(res, row.(*PlayerData))
+	}
+	return res, nil
+}
+
+// CountPlayer returns the number of records matching the filters of opts, ignoring pagination
+func (sp *SQLPlayer) CountPlayer(ctx context.Context, opts *ListOptions) (int64, error) {
+	return playerQuery.count(ctx, sp.db, opts)
+}
+
+func (sp *SQLPlayer) UpdatePlayer(ctx context.Context, id int64, player *PlayerData) (int64, error) {
+	if player == nil {
+		return 0, errors.New("invalid data")
+	}
+
+	fields := make([]string, 0, 3)
+	if player.Name != "" {
+		fields = append(fields, "name")
+	}
+	if player.Level != 0 {
+		fields = append(fields, "level")
+	}
+	if player.Score != 0 {
+		fields = append(fields, "score")
+	}
+
+	q, args, err := playerUpdateQuery(id, player, fields)
+	if err != nil {
+		return 0, err
+	}
+	rowsAffected, err := update(ctx, sp.db, q, args)
+	if err != nil {
+		return 0, err
+	}
+
+	return rowsAffected, nil
+}
+
+// playerWritableColumns is the list of columns which PatchPlayer accepts
+var playerWritableColumns = map[string]bool{
+	"name":  true,
+	"level": true,
+	"score": true,
+}
+
+// PatchPlayer updates exactly the columns listed in fields with the values of player, zero values included,
+// and returns the record after the update read in the same transaction.
+// It returns ErrNotFound when the record doesn't exist.
+func (sp *SQLPlayer) PatchPlayer(ctx context.Context, id int64, player *PlayerData, fields []string) (*PlayerData, error) {
+	if player == nil {
+		return nil, errors.New("invalid data")
+	}
+
+	q, args, err := playerUpdateQuery(id, player, fields)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := sp.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	// it's a no-op once the transaction is committed
+	defer tx.Rollback()
+
+	if _, err := update(ctx, tx, q, args); err != nil {
+		return nil, err
+	}
+
+	data := &PlayerData{}
+	readCtx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+	err = tx.QueryRowContext(readCtx, `SELECT id, name, level, score FROM players WHERE id = ?`, id).
+		Scan(&data.ID, &data.Name, &data.Level, &data.Score)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// playerUpdateQuery builds the UPDATE statement of the columns listed in fields
+func playerUpdateQuery(id int64, player *PlayerData, fields []string) (string, []interface{}, error) {
+	args := make([]interface{}, 0, len(fields)+1)
+
+	q := `UPDATE players SET id = id`
+	for _, f := range fields {
+		if !playerWritableColumns[f] {
+			return "", nil, fmt.Errorf("%w: %s", ErrUnknownColumn, f)
+		}
+		q += `, ` + f + ` = ?`
+		switch f {
+		case "name":
+			args = append(args, player.Name)
+		case "level":
+			args = append(args, player.Level)
+		case "score":
+			args = append(args, player.Score)
+		}
+	}
+	q += ` WHERE id = ?`
+	args = append(args, id)
+
+	return q, args, nil
+}
+
+func (sp *SQLPlayer) DeletePlayer(ctx context.Context, id int64) (int64, error) {
+	q := `DELETE FROM players WHERE id = ?`
+	rowsAffected, err := update(ctx, sp.db, q, []interface{}{id})
+	if err != nil {
+		return 0, err
+	}
+
+	return rowsAffected, nil
+}
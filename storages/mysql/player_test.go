@@ -0,0 +1,172 @@
+package mysql
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestCreatePlayer(t *testing.T) {
+	type in struct {
+		Player *PlayerData
+	}
+	type out struct {
+		Expected int64
+		Error    error
+	}
+	type testCase struct {
+		Scenario string
+		In       *in
+		Out      *out
+	}
+
+	testCases := []testCase{
+		{
+			"success case",
+			&in{
+				Player: &PlayerData{
+					Name:  "alice",
+					Level: int64(3),
+				},
+			},
+			&out{
+				Expected: int64(1),
+			},
+		},
+		{
+			"failure case, invalid data sent",
+			&in{
+				Player: nil,
+			},
+			&out{
+				Expected: 0,
+				Error:    errors.New("invalid data"),
+			},
+		},
+	}
+
+	truncateTestTable(t, "players")
+	for _, testCase := range testCases {
+		in := testCase.In
+		out := testCase.Out
+		pc := NewPlayer(testDB)
+		id, err := pc.CreatePlayer(context.Background(), in.Player)
+		if out.Expected != id {
+			t.Errorf("test failed, got: %v, want: %v", id, out.Expected)
+		}
+
+		switch {
+		case err != nil && out.Error == nil:
+			t.Errorf("expected non error, but some error occurred, %s", err.Error())
+		case err == nil && out.Error != nil:
+			t.Errorf("expected error %s, but results: no error", out.Error.Error())
+		}
+	}
+}
+
+func TestGetPlayer(t *testing.T) {
+	truncateTestTable(t, "players")
+	pc := NewPlayer(testDB)
+	pc.CreatePlayer(context.Background(), &PlayerData{Name: "alice"})
+
+	got, err := pc.GetPlayer(context.Background(), 1)
+	if err != nil {
+		t.Errorf("expected non error, but some error occurred, %s", err.Error())
+	}
+	// level defaults to 1 when it's not given
+	want := &PlayerData{ID: 1, Name: "alice", Level: 1}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("test failed, got: %v, want: %v", got, want)
+	}
+
+	if _, err := pc.GetPlayer(context.Background(), 2); err == nil {
+		t.Errorf("expected error, but results: no error")
+	}
+}
+
+func TestListPlayer(t *testing.T) {
+	truncateTestTable(t, "players")
+	pc := NewPlayer(testDB)
+	for _, name := range []string{"alice", "bob", "carol"} {
+		pc.CreatePlayer(context.Background(), &PlayerData{Name: name})
+	}
+
+	type testCase struct {
+		Scenario string
+		In       *ListOptions
+		Expected []int64
+	}
+	testCases := []testCase{
+		{"first page", &ListOptions{Limit: 2}, []int64{1, 2}},
+		{"after cursor", &ListOptions{Limit: 2, After: 2}, []int64{3}},
+		{"before cursor", &ListOptions{Limit: 1, Before: 3}, []int64{2}},
+	}
+	for _, tc := range testCases {
+		rows, err := pc.ListPlayer(context.Background(), tc.In)
+		if err != nil {
+			t.Errorf("%s: expected non error, but some error occurred, %s", tc.Scenario, err.Error())
+			continue
+		}
+		got := []int64{}
+		for _, d := range rows {
+			got = append(got, d.ID)
+		}
+		if !reflect.DeepEqual(tc.Expected, got) {
+			t.Errorf("%s: test failed, got: %v, want: %v", tc.Scenario, got, tc.Expected)
+		}
+	}
+
+	total, err := pc.CountPlayer(context.Background(), &ListOptions{Limit: 1})
+	if err != nil || total != 3 {
+		t.Errorf("test failed, got: %v, %v, want: 3", total, err)
+	}
+}
+
+func TestPatchPlayer(t *testing.T) {
+	truncateTestTable(t, "players")
+	pc := NewPlayer(testDB)
+	pc.CreatePlayer(context.Background(), &PlayerData{Name: "alice"})
+
+	got, err := pc.PatchPlayer(context.Background(), 1, &PlayerData{Score: 10}, []string{"score"})
+	if err != nil {
+		t.Errorf("expected non error, but some error occurred, %s", err.Error())
+	}
+	want := &PlayerData{ID: 1, Name: "alice", Level: 1, Score: 10}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("test failed, got: %v, want: %v", got, want)
+	}
+
+	// the listed fields are set even to the zero value
+	got, err = pc.PatchPlayer(context.Background(), 1, &PlayerData{}, []string{"score"})
+	if err != nil {
+		t.Errorf("expected non error, but some error occurred, %s", err.Error())
+	}
+	want.Score = 0
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("test failed, got: %v, want: %v", got, want)
+	}
+
+	if _, err := pc.PatchPlayer(context.Background(), 2, &PlayerData{Score: 10}, []string{"score"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("test failed, got: %v, want: %v", err, ErrNotFound)
+	}
+}
+
+func TestDeletePlayer(t *testing.T) {
+	truncateTestTable(t, "players")
+	pc := NewPlayer(testDB)
+	pc.CreatePlayer(context.Background(), &PlayerData{Name: "alice"})
+
+	rowsAffected, err := pc.DeletePlayer(context.Background(), 1)
+	if err != nil {
+		t.Errorf("expected non error, but some error occurred, %s", err.Error())
+	}
+	if rowsAffected != 1 {
+		t.Errorf("test failed, got: %v, want: 1", rowsAffected)
+	}
+
+	rowsAffected, _ = pc.DeletePlayer(context.Background(), 1)
+	if rowsAffected != 0 {
+		t.Errorf("test failed, got: %v, want: 0", rowsAffected)
+	}
+}
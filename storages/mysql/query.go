@@ -0,0 +1,246 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	// ErrUnknownColumn is returned when sort or filter refers to a column which is not exposed
+	ErrUnknownColumn = errors.New("unknown column")
+	// ErrUnknownOperator is returned when a filter uses an unsupported comparison
+	ErrUnknownOperator = errors.New("unknown filter operator")
+	// ErrInvalidCursor is returned when cursor pagination is combined with offset or non-id sorting
+	ErrInvalidCursor = errors.New("cursor pagination requires sorting by id and no offset")
+)
+
+// filterOperators maps the operator names accepted in ListOptions to SQL
+var filterOperators = map[string]string{
+	"eq":  "=",
+	"ne":  "<>",
+	"gt":  ">",
+	"gte": ">=",
+	"lt":  "<",
+	"lte": "<=",
+}
+
+// SortField is a single column of ORDER BY clause
+type SortField struct {
+	Column string
+	Desc   bool
+}
+
+// Filter is a single condition of WHERE clause, e.g. int_val >= 10
+type Filter struct {
+	Column string
+	Op     string
+	Value  interface{}
+}
+
+// ListOptions describes which page of a table should be returned.
+// After and Before are keyset cursors on id, Offset is for offset pagination.
+type ListOptions struct {
+	Limit   int
+	Offset  int
+	After   int64
+	Before  int64
+	Sort    []SortField
+	Filters []Filter
+}
+
+// IsCursor reports whether the options use keyset pagination
+func (o *ListOptions) IsCursor() bool {
+	return o.After > 0 || o.Before > 0
+}
+
+// SortedByID reports whether the rows are ordered by id only, which is required by keyset pagination
+func (o *ListOptions) SortedByID() bool {
+	return len(o.Sort) == 0 || (len(o.Sort) == 1 && o.Sort[0].Column == "id")
+}
+
+// listQuery builds SELECT and COUNT statements for a table, restricted to whitelisted columns
+type listQuery struct {
+	table   string
+	columns []string
+	allowed map[string]bool
+}
+
+func newListQuery(table string, columns ...string) *listQuery {
+	allowed := make(map[string]bool, len(columns))
+	for _, c := range columns {
+		allowed[c] = true
+	}
+	return &listQuery{table: table, columns: columns, allowed: allowed}
+}
+
+func (lq *listQuery) where(opts *ListOptions, withCursor bool) (string, []interface{}, error) {
+	conds := []string{}
+	args := []interface{}{}
+
+	for _, f := range opts.Filters {
+		if !lq.allowed[f.Column] {
+			return "", nil, fmt.Errorf("%w: %s", ErrUnknownColumn, f.Column)
+		}
+		op := f.Op
+		if op == "" {
+			op = "eq"
+		}
+		sqlOp, ok := filterOperators[op]
+		if !ok {
+			return "", nil, fmt.Errorf("%w: %s", ErrUnknownOperator, op)
+		}
+		conds = append(conds, fmt.Sprintf("%s %s ?", f.Column, sqlOp))
+		args = append(args, f.Value)
+	}
+
+	if withCursor && opts.IsCursor() {
+		desc := len(opts.Sort) == 1 && opts.Sort[0].Desc
+		switch {
+		case opts.After > 0 && !desc, opts.Before > 0 && desc:
+			conds = append(conds, "id > ?")
+		default:
+			conds = append(conds, "id < ?")
+		}
+		if opts.After > 0 {
+			args = append(args, opts.After)
+		} else {
+			args = append(args, opts.Before)
+		}
+	}
+
+	if len(conds) == 0 {
+		return "", args, nil
+	}
+	return " WHERE " + strings.Join(conds, " AND "), args, nil
+}
+
+// orderBy always ends with id so that pages are stable. reverse flips every direction,
+// which is used to walk backwards from a Before cursor.
+func (lq *listQuery) orderBy(opts *ListOptions, reverse bool) (string, error) {
+	parts := []string{}
+	hasID := false
+	for _, s := range opts.Sort {
+		if !lq.allowed[s.Column] {
+			return "", fmt.Errorf("%w: %s", ErrUnknownColumn, s.Column)
+		}
+		if s.Column == "id" {
+			hasID = true
+		}
+		parts = append(parts, s.Column+direction(s.Desc != reverse))
+	}
+	if !hasID {
+		parts = append(parts, "id"+direction(reverse))
+	}
+
+	return " ORDER BY " + strings.Join(parts, ", "), nil
+}
+
+func direction(desc bool) string {
+	if desc {
+		return " DESC"
+	}
+	return " ASC"
+}
+
+// Select returns the statement and its arguments for one page of rows
+func (lq *listQuery) Select(opts *ListOptions) (string, []interface{}, error) {
+	if opts.IsCursor() && (opts.Offset > 0 || !opts.SortedByID()) {
+		return "", nil, ErrInvalidCursor
+	}
+
+	where, args, err := lq.where(opts, true)
+	if err != nil {
+		return "", nil, err
+	}
+	order, err := lq.orderBy(opts, opts.Before > 0)
+	if err != nil {
+		return "", nil, err
+	}
+
+	q := "SELECT " + strings.Join(lq.columns, ", ") + " FROM " + lq.table + where + order
+	if opts.Limit > 0 {
+		q += " LIMIT ?"
+		args = append(args, opts.Limit)
+		if opts.Offset > 0 {
+			q += " OFFSET ?"
+			args = append(args, opts.Offset)
+		}
+	}
+
+	return q, args, nil
+}
+
+// Count returns the statement and its arguments for the number of rows matching the filters
+func (lq *listQuery) Count(opts *ListOptions) (string, []interface{}, error) {
+	where, args, err := lq.where(opts, false)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return "SELECT COUNT(*) FROM " + lq.table + where, args, nil
+}
+
+// list runs Select of opts on db and reads every row with scan. The rows are always returned
+// in the requested order, even when walking backwards with Before.
+func (lq *listQuery) list(ctx context.Context, db *sql.DB, opts *ListOptions, scan func(rows *sql.Rows) (interface{}, error)) ([]interface{}, error) {
+	if opts == nil {
+		opts = &ListOptions{}
+	}
+
+	q, args, err := lq.Select(opts)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+	rows, err := db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := []interface{}{}
+	for rows.Next() {
+		data, err := scan(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		res = append(res, data)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if opts.Before > 0 {
+		for i, j := 0, len(res)-1; i < j; i, j = i+1, j-1 {
+			res[i], res[j] = res[j], res[i]
+		}
+	}
+
+	return res, nil
+}
+
+// count runs Count of opts on db
+func (lq *listQuery) count(ctx context.Context, db *sql.DB, opts *ListOptions) (int64, error) {
+	if opts == nil {
+		opts = &ListOptions{}
+	}
+
+	q, args, err := lq.Count(opts)
+	if err != nil {
+		return 0, err
+	}
+
+	var total int64
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+	if err := db.QueryRowContext(ctx, q, args...).Scan(&total); err != nil {
+		return 0, err
+	}
+
+	return total, nil
+}
@@ -0,0 +1,70 @@
+package mysql
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestListQuerySelect(t *testing.T) {
+	type out struct {
+		Query string
+		Args  []interface{}
+		Error error
+	}
+	type testCase struct {
+		Scenario string
+		In       *ListOptions
+		Out      *out
+	}
+
+	testCases := []testCase{
+		{
+			"success case, filter and sort",
+			&ListOptions{
+				Limit:   10,
+				Offset:  20,
+				Sort:    []SortField{{Column: "foo"}, {Column: "int_val", Desc: true}},
+				Filters: []Filter{{Column: "int_val", Op: "gte", Value: "10"}},
+			},
+			&out{
+				Query: "SELECT id, foo, int_val, version, created_at, updated_at FROM sample WHERE int_val >= ? ORDER BY foo ASC, int_val DESC, id ASC LIMIT ? OFFSET ?",
+				Args:  []interface{}{"10", 10, 20},
+			},
+		},
+		{
+			"success case, walk backwards from cursor",
+			&ListOptions{Limit: 5, Before: 42},
+			&out{
+				Query: "SELECT id, foo, int_val, version, created_at, updated_at FROM sample WHERE id < ? ORDER BY id DESC LIMIT ?",
+				Args:  []interface{}{int64(42), 5},
+			},
+		},
+		{
+			"failure case, unknown column",
+			&ListOptions{Filters: []Filter{{Column: "password", Value: "x"}}},
+			&out{Error: ErrUnknownColumn},
+		},
+		{
+			"failure case, cursor with non-id sort",
+			&ListOptions{After: 1, Sort: []SortField{{Column: "foo"}}},
+			&out{Error: ErrInvalidCursor},
+		},
+	}
+
+	for _, tc := range testCases {
+		q, args, err := sampleQuery.Select(tc.In)
+		if tc.Out.Error != nil {
+			if !errors.Is(err, tc.Out.Error) {
+				t.Errorf("%s: expected error %v, got: %v", tc.Scenario, tc.Out.Error, err)
+			}
+			continue
+		}
+		if q != tc.Out.Query {
+			t.Errorf("%s: test failed, got: %v, want: %v", tc.Scenario, q, tc.Out.Query)
+		}
+		if !reflect.DeepEqual(args, tc.Out.Args) {
+			t.Errorf("%s: test failed, got: %v, want: %v", tc.Scenario, args, tc.Out.Args)
+		}
+	}
+}
@@ -1,17 +1,29 @@
 package mysql
 
 import (
+	"context"
 	"database/sql"
 	"errors"
+	"fmt"
+	"strings"
+	"time"
 
 	_ "github.com/go-sql-driver/mysql"
 )
 
 type Sample interface {
-	CreateSample(sample *SampleData) (int64, error)
-	GetSample(id int64) (*SampleData, error)
-	GetManySample() ([]*SampleData, error)
-	UpdateSample(int64, *SampleData) (int64, error)
+	CreateSample(ctx context.Context, sample *SampleData) (int64, error)
+	GetSample(ctx context.Context, id int64) (*SampleData, error)
+	GetManySample(ctx context.Context) ([]*SampleData, error)
+	ListSample(ctx context.Context, opts *ListOptions) ([]*SampleData, error)
+	CountSample(ctx context.Context, opts *ListOptions) (int64, error)
+	UpdateSample(ctx context.Context, id int64, sample *SampleData) (int64, error)
+	UpdateSampleFields(ctx context.Context, id int64, sample *SampleData, fields []string) (int64, error)
+	PatchSample(ctx context.Context, id int64, sample *SampleData, fields []string) (*SampleData, error)
+	ReplaceSample(ctx context.Context, id int64, sample *SampleData) (int64, error)
+	PutSample(ctx context.Context, id int64, sample *SampleData) (*SampleData, error)
+	DeleteSample(ctx context.Context, id int64) (int64, error)
+	BulkSample(ctx context.Context, ops []*BulkOperation, atomic bool) ([]*BulkResult, error)
 }
 
 func NewSample(dbConn *sql.DB) Sample {
@@ -26,29 +38,48 @@ type SQLSample struct {
 
 // SampleData is data structure that is corresponding to the table `sample`
 type SampleData struct {
-	ID     int64  `json:"id"`
-	Foo    string `json:"foo"`
-	IntVal int64  `json:"int_val"`
+	ID     int64  `json:"id" xml:"id"`
+	Foo    string `json:"foo" xml:"foo"`
+	IntVal int64  `json:"int_val" xml:"int_val"`
+	// Version is incremented on every change, it's used for optimistic concurrency control
+	Version   int64     `json:"version" xml:"version"`
+	CreatedAt time.Time `json:"created_at" xml:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" xml:"updated_at"`
 }
 
-func (sc *SQLSample) CreateSample(sample *SampleData) (int64, error) {
+// ErrVersionConflict is returned when the record was modified since the given version
+var ErrVersionConflict = errors.New("version conflict")
+
+// sampleColumns is the list of columns scanned by scanSample
+const sampleColumns = `id, foo, int_val, version, created_at, updated_at`
+
+// scanSample scans a row of sampleColumns, the DSN needs parseTime=true for the timestamps
+func scanSample(row interface{ Scan(...interface{}) error }) (*SampleData, error) {
+	data := &SampleData{}
+	if err := row.Scan(&data.ID, &data.Foo, &data.IntVal, &data.Version, &data.CreatedAt, &data.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (sc *SQLSample) CreateSample(ctx context.Context, sample *SampleData) (int64, error) {
 	if sample == nil {
 		return 0, errors.New("invalid data")
 	}
 
 	q := `INSERT INTO sample (foo, int_val) VALUES (?, ?)`
-	id, err := insert(sc.db, q, sample.Foo, sample.IntVal)
+	id, err := insert(ctx, sc.db, q, sample.Foo, sample.IntVal)
 	if err != nil {
 		return 0, err
 	}
 	return id, nil
 }
 
-func (sc *SQLSample) GetSample(id int64) (*SampleData, error) {
-	data := &SampleData{}
-
-	q := `SELECT id, foo, int_val FROM sample WHERE id = ?`
-	err := sc.db.QueryRow(q, id).Scan(&data.ID, &data.Foo, &data.IntVal)
+func (sc *SQLSample) GetSample(ctx context.Context, id int64) (*SampleData, error) {
+	q := `SELECT ` + sampleColumns + ` FROM sample WHERE id = ?`
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+	data, err := scanSample(sc.db.QueryRowContext(ctx, q, id))
 	if err != nil {
 		return nil, err
 	}
@@ -56,47 +87,312 @@ func (sc *SQLSample) GetSample(id int64) (*SampleData, error) {
 	return data, nil
 }
 
-func (sc *SQLSample) GetManySample() ([]*SampleData, error) {
-	q := `SELECT id, foo, int_val FROM sample ORDER BY ID ASC`
-	rows, err := sc.db.Query(q)
+func (sc *SQLSample) GetManySample(ctx context.Context) ([]*SampleData, error) {
+	q := `SELECT ` + sampleColumns + ` FROM sample ORDER BY ID ASC`
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+	rows, err := sc.db.QueryContext(ctx, q)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
 	res := []*SampleData{}
 	for rows.Next() {
-		data := &SampleData{}
-		err := rows.Scan(&data.ID, &data.Foo, &data.IntVal)
+		data, err := scanSample(rows)
 		if err != nil {
 			return nil, err
 		}
 
 		res = append(res, data)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
 
 	return res, nil
 }
 
-func (sc *SQLSample) UpdateSample(id int64, sample *SampleData) (int64, error) {
-	args := make([]interface{}, 0, 3)
+// sampleQuery is the list query builder for the table `sample`, it rejects any other columns
+var sampleQuery = newListQuery("sample", "id", "foo", "int_val", "version", "created_at", "updated_at")
 
+// ListSample returns one page of records filtered and sorted by opts.
+// The rows are always returned in the requested order, even when walking backwards with Before.
+func (sc *SQLSample) ListSample(ctx context.Context, opts *ListOptions) ([]*SampleData, error) {
+	rows, err := sampleQuery.list(ctx, sc.db, opts, func(rows *sql.Rows) (interface{}, error) {
+		return scanSample(rows)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]*SampleData, 0, len(rows))
+	for _, row := range rows {
+		res = append(res, row.(*SampleData))
+	}
+	return res, nil
+}
+
+// CountSample returns the number of records matching the filters of opts, ignoring pagination
+func (sc *SQLSample) CountSample(ctx context.Context, opts *ListOptions) (int64, error) {
+	return sampleQuery.count(ctx, sc.db, opts)
+}
+
+// UpdateSample updates the non-zero fields of sample, see UpdateSampleFields
+func (sc *SQLSample) UpdateSample(ctx context.Context, id int64, sample *SampleData) (int64, error) {
 	if sample == nil {
 		return 0, errors.New("invalid data")
 	}
 
-	q := `UPDATE sample SET id = id`
+	fields := make([]string, 0, 2)
 	if sample.Foo != "" {
-		q += `, foo = ?`
-		args = append(args, sample.Foo)
+		fields = append(fields, "foo")
 	}
 	if sample.IntVal != 0 {
-		q += `, int_val = ?`
-		args = append(args, sample.IntVal)
+		fields = append(fields, "int_val")
+	}
+
+	return sc.UpdateSampleFields(ctx, id, sample, fields)
+}
+
+// sampleWritableColumns is the list of columns which UpdateSampleFields accepts
+var sampleWritableColumns = map[string]bool{
+	"foo":     true,
+	"int_val": true,
+}
+
+// UpdateSampleFields updates exactly the columns listed in fields with the values of sample,
+// zero values included, and increments the version when anything changes.
+// When sample.Version is given, the record is updated only if it's still at that version,
+// otherwise ErrVersionConflict is returned.
+func (sc *SQLSample) UpdateSampleFields(ctx context.Context, id int64, sample *SampleData, fields []string) (int64, error) {
+	if sample == nil {
+		return 0, errors.New("invalid data")
+	}
+
+	q, args, err := sampleUpdateQuery(id, sample, fields)
+	if err != nil {
+		return 0, err
+	}
+	rowsAffected, err := update(ctx, sc.db, q, args)
+	if err != nil {
+		return 0, err
+	}
+	if rowsAffected == 0 && sample.Version != 0 {
+		if err := sc.checkVersion(ctx, id, sample.Version); err != nil {
+			return 0, err
+		}
+	}
+
+	return rowsAffected, nil
+}
+
+// PatchSample updates the fields as UpdateSampleFields does, and returns the record after the update
+// read in the same transaction. It returns ErrNotFound when the record doesn't exist.
+func (sc *SQLSample) PatchSample(ctx context.Context, id int64, sample *SampleData, fields []string) (*SampleData, error) {
+	if sample == nil {
+		return nil, errors.New("invalid data")
+	}
+
+	q, args, err := sampleUpdateQuery(id, sample, fields)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := sc.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	// it's a no-op once the transaction is committed
+	defer tx.Rollback()
+
+	rowsAffected, err := update(ctx, tx, q, args)
+	if err != nil {
+		return nil, err
+	}
+	if rowsAffected == 0 {
+		if err := unchangedSampleError(ctx, tx, id, sample.Version); err != nil {
+			return nil, err
+		}
+	}
+
+	readCtx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+	data, err := scanSample(tx.QueryRowContext(readCtx, `SELECT `+sampleColumns+` FROM sample WHERE id = ?`, id))
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// sampleUpdateQuery builds the UPDATE statement of UpdateSampleFields
+func sampleUpdateQuery(id int64, sample *SampleData, fields []string) (string, []interface{}, error) {
+	sets := []string{}
+	same := []string{}
+	setArgs := make([]interface{}, 0, len(fields))
+	for _, f := range fields {
+		if !sampleWritableColumns[f] {
+			return "", nil, fmt.Errorf("%w: %s", ErrUnknownColumn, f)
+		}
+		sets = append(sets, f+` = ?`)
+		same = append(same, f+` <=> ?`)
+		switch f {
+		case "foo":
+			setArgs = append(setArgs, sample.Foo)
+		case "int_val":
+			setArgs = append(setArgs, sample.IntVal)
+		}
+	}
+
+	q := `UPDATE sample SET id = id`
+	args := make([]interface{}, 0, 2*len(setArgs)+2)
+	if len(sets) > 0 {
+		// MySQL evaluates the assignments from left to right, so the version is compared with the old values
+		q = `UPDATE sample SET version = IF(` + strings.Join(same, ` AND `) + `, version, version + 1), ` + strings.Join(sets, `, `)
+		args = append(args, setArgs...)
+		args = append(args, setArgs...)
 	}
 	q += ` WHERE id = ?`
 	args = append(args, id)
+	if sample.Version != 0 {
+		q += ` AND version = ?`
+		args = append(args, sample.Version)
+	}
+
+	return q, args, nil
+}
+
+// ReplaceSample overwrites every column of the record, unlike UpdateSample
+// which only touches non-zero fields. sample.Version works as in UpdateSample.
+func (sc *SQLSample) ReplaceSample(ctx context.Context, id int64, sample *SampleData) (int64, error) {
+	if sample == nil {
+		return 0, errors.New("invalid data")
+	}
+
+	q := `UPDATE sample SET foo = ?, int_val = ?, version = version + 1 WHERE id = ?`
+	args := []interface{}{sample.Foo, sample.IntVal, id}
+	if sample.Version != 0 {
+		q += ` AND version = ?`
+		args = append(args, sample.Version)
+	}
+
+	rowsAffected, err := update(ctx, sc.db, q, args)
+	if err != nil {
+		return 0, err
+	}
+	if rowsAffected == 0 && sample.Version != 0 {
+		if err := sc.checkVersion(ctx, id, sample.Version); err != nil {
+			return 0, err
+		}
+	}
+
+	return rowsAffected, nil
+}
+
+// PutSample overwrites every column of the record as ReplaceSample does, and returns the record after the update.
+// The version is checked and the record is read in the same transaction, so a concurrent update or delete can't
+// slip in between. It returns ErrNotFound when the record doesn't exist.
+func (sc *SQLSample) PutSample(ctx context.Context, id int64, sample *SampleData) (*SampleData, error) {
+	if sample == nil {
+		return nil, errors.New("invalid data")
+	}
+
+	tx, err := sc.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	// it's a no-op once the transaction is committed
+	defer tx.Rollback()
+
+	// lock the record until the transaction ends
+	lockCtx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+	var current int64
+	err = tx.QueryRowContext(lockCtx, `SELECT version FROM sample WHERE id = ? FOR UPDATE`, id).Scan(&current)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if sample.Version != 0 && sample.Version != current {
+		return nil, ErrVersionConflict
+	}
+
+	q := `UPDATE sample SET foo = ?, int_val = ?, version = version + 1 WHERE id = ?`
+	if _, err := update(ctx, tx, q, []interface{}{sample.Foo, sample.IntVal, id}); err != nil {
+		return nil, err
+	}
+
+	readCtx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+	data, err := scanSample(tx.QueryRowContext(readCtx, `SELECT `+sampleColumns+` FROM sample WHERE id = ?`, id))
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// checkVersion tells why a conditional update didn't affect any row.
+// It returns ErrVersionConflict if the record exists at another version, nil otherwise.
+func (sc *SQLSample) checkVersion(ctx context.Context, id int64, version int64) error {
+	current, err := sampleVersion(ctx, sc.db, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if current != version {
+		return ErrVersionConflict
+	}
+
+	return nil
+}
+
+// unchangedSampleError tells why an update of the record didn't affect any row.
+// It returns ErrNotFound if the record doesn't exist, ErrVersionConflict if version is given and
+// the record is at another one, and nil if the values were already the same.
+func unchangedSampleError(ctx context.Context, db queryer, id int64, version int64) error {
+	current, err := sampleVersion(ctx, db, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if version != 0 && current != version {
+		return ErrVersionConflict
+	}
+
+	return nil
+}
+
+// sampleVersion returns the current version of the record, sql.ErrNoRows if it doesn't exist
+func sampleVersion(ctx context.Context, db queryer, id int64) (int64, error) {
+	q := `SELECT version FROM sample WHERE id = ?`
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	var current int64
+	if err := db.QueryRowContext(ctx, q, id).Scan(&current); err != nil {
+		return 0, err
+	}
+
+	return current, nil
+}
 
-	rowsAffected, err := update(sc.db, q, args)
+func (sc *SQLSample) DeleteSample(ctx context.Context, id int64) (int64, error) {
+	q := `DELETE FROM sample WHERE id = ?`
+	rowsAffected, err := update(ctx, sc.db, q, []interface{}{id})
 	if err != nil {
 		return 0, err
 	}
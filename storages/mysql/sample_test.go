@@ -1,14 +1,12 @@
 package mysql
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"reflect"
 	"testing"
-
-	"github.com/golang/mock/gomock"
-	//"github.com/stretchr/testify/require"
-	mock_mysql "github.com/sunao-uehara/go-restapi-sample/storages/mysql/mock"
+	"time"
 )
 
 var testSample1 = &SampleData{
@@ -23,6 +21,15 @@ var testSample2 = &SampleData{
 	IntVal: int64(1002),
 }
 
+// withoutTimestamps clears the timestamps set by MySQL, so that the data can be compared with the expected one
+func withoutTimestamps(d *SampleData) *SampleData {
+	if d != nil {
+		d.CreatedAt = time.Time{}
+		d.UpdatedAt = time.Time{}
+	}
+	return d
+}
+
 type mockSample struct {
 }
 
@@ -30,32 +37,68 @@ func NewMockSample() Sample {
 	return &mockSample{}
 }
 
-func (msc *mockSample) CreateSample(sample *SampleData) (int64, error) {
+func (msc *mockSample) CreateSample(ctx context.Context, sample *SampleData) (int64, error) {
 	if sample.ID != 0 {
 		return sample.ID, nil
 	}
 	return 1, nil
 }
 
-func (msc *mockSample) GetSample(id int64) (*SampleData, error) {
+func (msc *mockSample) GetSample(ctx context.Context, id int64) (*SampleData, error) {
 	return testSample1, nil
 }
 
-func (msc *mockSample) GetManySample() ([]*SampleData, error) {
+func (msc *mockSample) GetManySample(ctx context.Context) ([]*SampleData, error) {
 	return []*SampleData{
 		testSample1,
 		testSample2,
 	}, nil
 }
 
-func (msc *mockSample) UpdateSample(id int64, sample *SampleData) (int64, error) {
+func (msc *mockSample) ListSample(ctx context.Context, opts *ListOptions) ([]*SampleData, error) {
+	return msc.GetManySample(ctx)
+}
+
+func (msc *mockSample) CountSample(ctx context.Context, opts *ListOptions) (int64, error) {
+	return 2, nil
+}
+
+func (msc *mockSample) UpdateSample(ctx context.Context, id int64, sample *SampleData) (int64, error) {
 	return 1, nil
 }
 
+func (msc *mockSample) UpdateSampleFields(ctx context.Context, id int64, sample *SampleData, fields []string) (int64, error) {
+	return 1, nil
+}
+
+func (msc *mockSample) PatchSample(ctx context.Context, id int64, sample *SampleData, fields []string) (*SampleData, error) {
+	return testSample1, nil
+}
+
+func (msc *mockSample) ReplaceSample(ctx context.Context, id int64, sample *SampleData) (int64, error) {
+	return 1, nil
+}
+
+func (msc *mockSample) PutSample(ctx context.Context, id int64, sample *SampleData) (*SampleData, error) {
+	return testSample1, nil
+}
+
+func (msc *mockSample) DeleteSample(ctx context.Context, id int64) (int64, error) {
+	return 1, nil
+}
+
+func (msc *mockSample) BulkSample(ctx context.Context, ops []*BulkOperation, atomic bool) ([]*BulkResult, error) {
+	results := make([]*BulkResult, len(ops))
+	for i, op := range ops {
+		results[i] = &BulkResult{ID: op.ID}
+	}
+	return results, nil
+}
+
 // use custom mock
 func TestCreateSample2(t *testing.T) {
 	sc := NewMockSample()
-	id, err := sc.CreateSample(testSample1)
+	id, err := sc.CreateSample(context.Background(), testSample1)
 	if err != nil {
 		t.Errorf("test failed, error: %v", err)
 	}
@@ -64,16 +107,6 @@ func TestCreateSample2(t *testing.T) {
 	}
 }
 
-// use mock generated by mockgen
-func TestCreateSample3(t *testing.T) {
-
-	ctrl := gomock.NewController(t)
-	defer ctrl.Finish()
-
-	sample := mock_mysql.NewMockSample(ctrl)
-
-}
-
 func TestCreateSample(t *testing.T) {
 	type in struct {
 		Sample *SampleData
@@ -125,12 +158,12 @@ func TestCreateSample(t *testing.T) {
 		},
 	}
 
-	createTestTable("sample")
+	truncateTestTable(t, "sample")
 	for _, testCase := range testCases {
 		in := testCase.In
 		out := testCase.Out
 		sc := NewSample(testDB)
-		id, err := sc.CreateSample(in.Sample)
+		id, err := sc.CreateSample(context.Background(), in.Sample)
 		if testCase.Out.Expected != id {
 			t.Errorf("test failed, got: %v, want: %v", id, testCase.Out.Expected)
 		}
@@ -145,14 +178,14 @@ func TestCreateSample(t *testing.T) {
 		}
 
 	}
-	deleteTestTable("sample")
 }
 
 func TestGetSample(t *testing.T) {
 	testData := &SampleData{
-		ID:     int64(1),
-		Foo:    "var",
-		IntVal: int64(100),
+		ID:      int64(1),
+		Foo:     "var",
+		IntVal:  int64(100),
+		Version: int64(1),
 	}
 
 	type in struct {
@@ -190,14 +223,14 @@ func TestGetSample(t *testing.T) {
 		},
 	}
 
-	createTestTable("sample")
+	truncateTestTable(t, "sample")
 	sc := NewSample(testDB)
-	sc.CreateSample(testData)
+	sc.CreateSample(context.Background(), testData)
 	for _, testCase := range testCases {
 		in := testCase.In
 		out := testCase.Out
-		got, err := sc.GetSample(in.ID)
-		if !reflect.DeepEqual(out.Expected, got) {
+		got, err := sc.GetSample(context.Background(), in.ID)
+		if !reflect.DeepEqual(out.Expected, withoutTimestamps(got)) {
 			t.Errorf("test failed, got: %v, want: %v", got, testCase.Out.Expected)
 		}
 
@@ -210,20 +243,21 @@ func TestGetSample(t *testing.T) {
 			// fmt.Println(err)
 		}
 	}
-	deleteTestTable("sample")
 }
 
 func TestGetManySample(t *testing.T) {
 	testDataList := []*SampleData{
 		{
-			ID:     int64(1),
-			Foo:    "var",
-			IntVal: int64(101),
+			ID:      int64(1),
+			Foo:     "var",
+			IntVal:  int64(101),
+			Version: int64(1),
 		},
 		{
-			ID:     int64(2),
-			Foo:    "var2",
-			IntVal: int64(102),
+			ID:      int64(2),
+			Foo:     "var2",
+			IntVal:  int64(102),
+			Version: int64(1),
 		},
 	}
 
@@ -245,21 +279,23 @@ func TestGetManySample(t *testing.T) {
 		},
 	}
 
-	createTestTable("sample")
+	truncateTestTable(t, "sample")
 	sc := NewSample(testDB)
 	for _, d := range testDataList {
-		sc.CreateSample(d)
+		sc.CreateSample(context.Background(), d)
 	}
 	for _, testCase := range testCases {
 		out := testCase.Out
-		got, _ := sc.GetManySample()
+		got, _ := sc.GetManySample(context.Background())
+		for _, d := range got {
+			withoutTimestamps(d)
+		}
 		if !reflect.DeepEqual(out.Expected, got) {
 			gotStr, _ := json.Marshal(got)
 			expectedStr, _ := json.Marshal(out.Expected)
 			t.Errorf("test failed, got: %v, want: %v", string(gotStr), string(expectedStr))
 		}
 	}
-	deleteTestTable("sample")
 }
 
 func TestUpdateSample(t *testing.T) {
@@ -296,9 +332,10 @@ func TestUpdateSample(t *testing.T) {
 			&out{
 				RowsAffected: int64(1),
 				Expected: &SampleData{
-					ID:     int64(1),
-					Foo:    "var mod 1",
-					IntVal: int64(100),
+					ID:      int64(1),
+					Foo:     "var mod 1",
+					IntVal:  int64(100),
+					Version: int64(2),
 				},
 			},
 		},
@@ -314,9 +351,10 @@ func TestUpdateSample(t *testing.T) {
 			&out{
 				RowsAffected: int64(1),
 				Expected: &SampleData{
-					ID:     int64(1),
-					Foo:    "var mod 2",
-					IntVal: int64(101),
+					ID:      int64(1),
+					Foo:     "var mod 2",
+					IntVal:  int64(101),
+					Version: int64(3),
 				},
 			},
 		},
@@ -332,9 +370,10 @@ func TestUpdateSample(t *testing.T) {
 			&out{
 				RowsAffected: int64(0),
 				Expected: &SampleData{
-					ID:     int64(1),
-					Foo:    "var mod 2",
-					IntVal: int64(101),
+					ID:      int64(1),
+					Foo:     "var mod 2",
+					IntVal:  int64(101),
+					Version: int64(3),
 				},
 			},
 		},
@@ -362,28 +401,29 @@ func TestUpdateSample(t *testing.T) {
 				RowsAffected: int64(0),
 				// the original data shouldn't be changed
 				Expected: &SampleData{
-					ID:     int64(1),
-					Foo:    "var mod 2",
-					IntVal: int64(101),
+					ID:      int64(1),
+					Foo:     "var mod 2",
+					IntVal:  int64(101),
+					Version: int64(3),
 				},
 				Error: errors.New("invalid data"),
 			},
 		},
 	}
 
-	createTestTable("sample")
+	truncateTestTable(t, "sample")
 	sc := NewSample(testDB)
-	sc.CreateSample(testData)
+	sc.CreateSample(context.Background(), testData)
 	for _, testCase := range testCases {
 		in := testCase.In
 		out := testCase.Out
-		got, err := sc.UpdateSample(in.ID, in.Data)
+		got, err := sc.UpdateSample(context.Background(), in.ID, in.Data)
 		if out.RowsAffected != got {
 			t.Errorf("test failed, got: %v, want: %v", got, testCase.Out.RowsAffected)
 		}
 
-		updated, _ := sc.GetSample(in.ID)
-		if !reflect.DeepEqual(out.Expected, updated) {
+		updated, _ := sc.GetSample(context.Background(), in.ID)
+		if !reflect.DeepEqual(out.Expected, withoutTimestamps(updated)) {
 			t.Errorf("test failed, got: %v, want: %v", updated, testCase.Out.Expected)
 		}
 
@@ -396,5 +436,169 @@ func TestUpdateSample(t *testing.T) {
 			// fmt.Println(err)
 		}
 	}
-	deleteTestTable("sample")
+}
+
+func TestReplaceSample(t *testing.T) {
+	truncateTestTable(t, "sample")
+	sc := NewSample(testDB)
+	sc.CreateSample(context.Background(), &SampleData{Foo: "var", IntVal: int64(100)})
+
+	// zero values are written as well
+	rowsAffected, err := sc.ReplaceSample(context.Background(), 1, &SampleData{Foo: "var mod"})
+	if err != nil {
+		t.Errorf("expected non error, but some error occurred, %s", err.Error())
+	}
+	if rowsAffected != 1 {
+		t.Errorf("test failed, got: %v, want: 1", rowsAffected)
+	}
+
+	got, _ := sc.GetSample(context.Background(), 1)
+	want := &SampleData{ID: 1, Foo: "var mod", IntVal: 0, Version: 2}
+	if !reflect.DeepEqual(want, withoutTimestamps(got)) {
+		t.Errorf("test failed, got: %v, want: %v", got, want)
+	}
+
+	if _, err := sc.ReplaceSample(context.Background(), 1, nil); err == nil {
+		t.Errorf("expected error, but results: no error")
+	}
+}
+
+func TestPutSample(t *testing.T) {
+	truncateTestTable(t, "sample")
+	sc := NewSample(testDB)
+	sc.CreateSample(context.Background(), &SampleData{Foo: "var", IntVal: int64(100)})
+
+	type out struct {
+		Expected *SampleData
+		Error    error
+	}
+	type testCase struct {
+		Scenario string
+		ID       int64
+		In       *SampleData
+		Out      *out
+	}
+	testCases := []testCase{
+		{"success case", 1, &SampleData{Foo: "first", Version: 1}, &out{Expected: &SampleData{ID: 1, Foo: "first", Version: 2}}},
+		{"success case, any version", 1, &SampleData{Foo: "second", IntVal: 1}, &out{Expected: &SampleData{ID: 1, Foo: "second", IntVal: 1, Version: 3}}},
+		{"failure case, stale version", 1, &SampleData{Foo: "third", Version: 1}, &out{Error: ErrVersionConflict}},
+		{"failure case, missing record", 2, &SampleData{Foo: "third"}, &out{Error: ErrNotFound}},
+	}
+	for _, tc := range testCases {
+		got, err := sc.PutSample(context.Background(), tc.ID, tc.In)
+		if !errors.Is(err, tc.Out.Error) {
+			t.Errorf("%s: test failed, got: %v, want: %v", tc.Scenario, err, tc.Out.Error)
+		}
+		if !reflect.DeepEqual(tc.Out.Expected, withoutTimestamps(got)) {
+			t.Errorf("%s: test failed, got: %v, want: %v", tc.Scenario, got, tc.Out.Expected)
+		}
+	}
+}
+
+func TestDeleteSample(t *testing.T) {
+	truncateTestTable(t, "sample")
+	sc := NewSample(testDB)
+	sc.CreateSample(context.Background(), &SampleData{Foo: "var", IntVal: int64(100)})
+
+	rowsAffected, err := sc.DeleteSample(context.Background(), 1)
+	if err != nil {
+		t.Errorf("expected non error, but some error occurred, %s", err.Error())
+	}
+	if rowsAffected != 1 {
+		t.Errorf("test failed, got: %v, want: 1", rowsAffected)
+	}
+
+	if _, err := sc.GetSample(context.Background(), 1); err == nil {
+		t.Errorf("expected error, but results: no error")
+	}
+
+	rowsAffected, _ = sc.DeleteSample(context.Background(), 1)
+	if rowsAffected != 0 {
+		t.Errorf("test failed, got: %v, want: 0", rowsAffected)
+	}
+}
+
+func TestUpdateSampleVersionConflict(t *testing.T) {
+	truncateTestTable(t, "sample")
+	sc := NewSample(testDB)
+	sc.CreateSample(context.Background(), &SampleData{Foo: "var", IntVal: int64(100)})
+
+	// the first writer wins
+	rowsAffected, err := sc.UpdateSample(context.Background(), 1, &SampleData{Foo: "first", Version: 1})
+	if err != nil || rowsAffected != 1 {
+		t.Errorf("test failed, got: %v, %v, want: 1, nil", rowsAffected, err)
+	}
+
+	// the second one is based on the old version
+	_, err = sc.UpdateSample(context.Background(), 1, &SampleData{Foo: "second", Version: 1})
+	if !errors.Is(err, ErrVersionConflict) {
+		t.Errorf("test failed, got: %v, want: %v", err, ErrVersionConflict)
+	}
+	_, err = sc.ReplaceSample(context.Background(), 1, &SampleData{Foo: "second", Version: 1})
+	if !errors.Is(err, ErrVersionConflict) {
+		t.Errorf("test failed, got: %v, want: %v", err, ErrVersionConflict)
+	}
+
+	got, err := sc.GetSample(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("expected non error, but some error occurred, %s", err.Error())
+	}
+	if got.Foo != "first" || got.Version != 2 {
+		t.Errorf("test failed, got: %v", got)
+	}
+}
+
+func TestUpdateSampleFields(t *testing.T) {
+	truncateTestTable(t, "sample")
+	sc := NewSample(testDB)
+	sc.CreateSample(context.Background(), &SampleData{Foo: "var", IntVal: int64(100)})
+
+	// zero values are written when they are in the field mask
+	rowsAffected, err := sc.UpdateSampleFields(context.Background(), 1, &SampleData{Foo: "ignored"}, []string{"int_val"})
+	if err != nil || rowsAffected != 1 {
+		t.Errorf("test failed, got: %v, %v, want: 1, nil", rowsAffected, err)
+	}
+	got, _ := sc.GetSample(context.Background(), 1)
+	want := &SampleData{ID: 1, Foo: "var", IntVal: 0, Version: 2}
+	if !reflect.DeepEqual(want, withoutTimestamps(got)) {
+		t.Errorf("test failed, got: %v, want: %v", got, want)
+	}
+
+	_, err = sc.UpdateSampleFields(context.Background(), 1, &SampleData{}, []string{"id"})
+	if !errors.Is(err, ErrUnknownColumn) {
+		t.Errorf("test failed, got: %v, want: %v", err, ErrUnknownColumn)
+	}
+}
+
+func TestPatchSample(t *testing.T) {
+	truncateTestTable(t, "sample")
+	sc := NewSample(testDB)
+	sc.CreateSample(context.Background(), &SampleData{Foo: "var", IntVal: int64(100)})
+
+	got, err := sc.PatchSample(context.Background(), 1, &SampleData{Foo: "var mod", Version: 1}, []string{"foo"})
+	if err != nil {
+		t.Errorf("expected non error, but some error occurred, %s", err.Error())
+	}
+	want := &SampleData{ID: 1, Foo: "var mod", IntVal: 100, Version: 2}
+	if !reflect.DeepEqual(want, withoutTimestamps(got)) {
+		t.Errorf("test failed, got: %v, want: %v", got, want)
+	}
+
+	// the same values don't change the record, but it's still returned
+	got, err = sc.PatchSample(context.Background(), 1, &SampleData{Foo: "var mod"}, []string{"foo"})
+	if err != nil {
+		t.Errorf("expected non error, but some error occurred, %s", err.Error())
+	}
+	if !reflect.DeepEqual(want, withoutTimestamps(got)) {
+		t.Errorf("test failed, got: %v, want: %v", got, want)
+	}
+
+	_, err = sc.PatchSample(context.Background(), 1, &SampleData{Foo: "second", Version: 1}, []string{"foo"})
+	if !errors.Is(err, ErrVersionConflict) {
+		t.Errorf("test failed, got: %v, want: %v", err, ErrVersionConflict)
+	}
+	_, err = sc.PatchSample(context.Background(), 2, &SampleData{Foo: "var"}, []string{"foo"})
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("test failed, got: %v, want: %v", err, ErrNotFound)
+	}
 }
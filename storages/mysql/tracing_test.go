@@ -0,0 +1,121 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// fakeConnector is a driver which executes nothing, like go-sql-driver/mysql it skips
+// the queries with arguments on the connection, so that they are prepared
+type fakeConnector struct{}
+
+func (fakeConnector) Connect(context.Context) (driver.Conn, error) { return fakeConn{}, nil }
+func (fakeConnector) Driver() driver.Driver                        { return nil }
+
+type fakeConn struct{}
+
+func (fakeConn) Prepare(query string) (driver.Stmt, error) { return fakeStmt{query}, nil }
+func (fakeConn) Close() error                              { return nil }
+func (fakeConn) Begin() (driver.Tx, error)                 { return fakeTx{}, nil }
+
+func (fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if len(args) > 0 {
+		return nil, driver.ErrSkip
+	}
+	return &fakeRows{}, nil
+}
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error   { return nil }
+func (fakeTx) Rollback() error { return nil }
+
+type fakeStmt struct {
+	query string
+}
+
+func (fakeStmt) Close() error  { return nil }
+func (fakeStmt) NumInput() int { return -1 }
+
+func (s fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	if s.query == "INSERT INTO missing VALUES (?)" {
+		return nil, errors.New("table doesn't exist")
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (fakeStmt) Query(args []driver.Value) (driver.Rows, error) { return &fakeRows{}, nil }
+
+type fakeRows struct{}
+
+func (*fakeRows) Columns() []string              { return []string{"id"} }
+func (*fakeRows) Close() error                   { return nil }
+func (*fakeRows) Next(dest []driver.Value) error { return io.EOF }
+
+func TestTracingConnector(t *testing.T) {
+	exp := tracetest.NewInMemoryExporter()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exp)))
+
+	db := sql.OpenDB(&tracingConnector{fakeConnector{}})
+	defer db.Close()
+	ctx, parent := otel.Tracer("test").Start(context.Background(), "request")
+
+	rows, err := db.QueryContext(ctx, `SELECT id FROM sample`)
+	if err != nil {
+		t.Fatalf("expected non error, but some error occurred, %s", err.Error())
+	}
+	rows.Close()
+	if _, err := db.ExecContext(ctx, `update sample SET foo = ? WHERE id = ?`, "a", 1); err != nil {
+		t.Fatalf("expected non error, but some error occurred, %s", err.Error())
+	}
+	if _, err := db.ExecContext(ctx, `INSERT INTO missing VALUES (?)`, 1); err == nil {
+		t.Fatalf("expected error, but no error occurred")
+	}
+	parent.End()
+
+	type testCase struct {
+		Name      string
+		Statement string
+		Error     bool
+	}
+	want := []testCase{
+		{"SELECT", `SELECT id FROM sample`, false},
+		{"UPDATE", `update sample SET foo = ? WHERE id = ?`, false},
+		{"INSERT", `INSERT INTO missing VALUES (?)`, true},
+	}
+	spans := exp.GetSpans()
+	if len(spans) != len(want)+1 {
+		t.Fatalf("test failed, got: %v spans, want: %v", len(spans), len(want)+1)
+	}
+	for i, tc := range want {
+		s := spans[i]
+		if s.Name != tc.Name {
+			t.Errorf("test failed, got: %v, want: %v", s.Name, tc.Name)
+		}
+		if s.Parent.SpanID() != parent.SpanContext().SpanID() {
+			t.Errorf("%s: test failed, the span is not a child of the request", tc.Name)
+		}
+		statement := ""
+		for _, kv := range s.Attributes {
+			if kv.Key == attribute.Key("db.statement") {
+				statement = kv.Value.AsString()
+			}
+		}
+		if statement != tc.Statement {
+			t.Errorf("%s: test failed, got: %v, want: %v", tc.Name, statement, tc.Statement)
+		}
+		if got := s.Status.Code == codes.Error; got != tc.Error {
+			t.Errorf("%s: test failed, got error: %v, want: %v", tc.Name, got, tc.Error)
+		}
+	}
+}
@@ -3,17 +3,32 @@ package redis
 import (
 	"context"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/go-redis/redis/v8"
 )
 
+// DefaultCacheTTL is how long SetCache keeps the value
+const DefaultCacheTTL = 5 * time.Minute
+
+// purgeChannel is the pub/sub channel which announces purged cache paths to every instance
+const purgeChannel = "cache:purge"
+
 func cacheKey(path string) string {
 	return fmt.Sprintf("cache:%s", path)
 }
 
+func tagKey(tag string) string {
+	return fmt.Sprintf("cachetag:%s", tag)
+}
+
 func SetCache(ctx context.Context, redisClient *redis.Client, path string, val interface{}) error {
-	err := redisClient.Set(ctx, cacheKey(path), val, 5*time.Minute).Err()
+	return SetCacheWithTTL(ctx, redisClient, path, val, DefaultCacheTTL)
+}
+
+func SetCacheWithTTL(ctx context.Context, redisClient *redis.Client, path string, val interface{}, ttl time.Duration) error {
+	err := redisClient.Set(ctx, cacheKey(path), val, ttl).Err()
 	if err != nil {
 		return err
 	}
@@ -38,3 +53,81 @@ func DelCache(ctx context.Context, redisClient *redis.Client, path string) error
 
 	return nil
 }
+
+// SetCacheWithTags stores val like SetCacheWithTTL and adds path to the set of every tag,
+// so that PurgeTags can find it later
+func SetCacheWithTags(ctx context.Context, redisClient *redis.Client, path string, val interface{}, ttl time.Duration, tags []string) error {
+	pipe := redisClient.TxPipeline()
+	pipe.Set(ctx, cacheKey(path), val, ttl)
+	for _, tag := range tags {
+		pipe.SAdd(ctx, tagKey(tag), path)
+		// every member is written with the same ttl, so the set lives as long as the latest one
+		pipe.Expire(ctx, tagKey(tag), ttl)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// PurgeTags deletes every cache tagged with one of tags and returns their paths
+func PurgeTags(ctx context.Context, redisClient *redis.Client, tags ...string) ([]string, error) {
+	if len(tags) == 0 {
+		return nil, nil
+	}
+
+	// read and drop the sets atomically, so that no path is added in between and lost
+	pipe := redisClient.TxPipeline()
+	cmds := make([]*redis.StringSliceCmd, 0, len(tags))
+	for _, tag := range tags {
+		cmds = append(cmds, pipe.SMembers(ctx, tagKey(tag)))
+		pipe.Del(ctx, tagKey(tag))
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{}
+	paths := []string{}
+	keys := []string{}
+	for _, cmd := range cmds {
+		for _, path := range cmd.Val() {
+			if seen[path] {
+				continue
+			}
+			seen[path] = true
+			paths = append(paths, path)
+			keys = append(keys, cacheKey(path))
+		}
+	}
+	if len(keys) == 0 {
+		return paths, nil
+	}
+	if err := redisClient.Del(ctx, keys...).Err(); err != nil {
+		return nil, err
+	}
+
+	return paths, nil
+}
+
+// PublishPurge announces that the cache of paths was purged
+func PublishPurge(ctx context.Context, redisClient *redis.Client, paths []string) error {
+	if len(paths) == 0 {
+		return nil
+	}
+	return redisClient.Publish(ctx, purgeChannel, strings.Join(paths, "\n")).Err()
+}
+
+// SubscribePurge returns the subscription of the purges announced by PublishPurge,
+// every message is a newline separated list of paths. The caller has to close it
+func SubscribePurge(ctx context.Context, redisClient *redis.Client) (*redis.PubSub, error) {
+	pubsub := redisClient.Subscribe(ctx, purgeChannel)
+	// wait for the confirmation so that no message is missed after returning
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		return nil, err
+	}
+
+	return pubsub, nil
+}
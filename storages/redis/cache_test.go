@@ -0,0 +1,40 @@
+package redis
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+func TestPurgeTags(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	ctx := context.Background()
+
+	SetCacheWithTags(ctx, rdb, "/sample/1", "1", time.Minute, []string{"sample:1"})
+	SetCacheWithTags(ctx, rdb, "/sample", "[1, 2]", time.Minute, []string{"sample:list"})
+	SetCacheWithTags(ctx, rdb, "/sample/2", "2", time.Minute, []string{"sample:2"})
+
+	paths, err := PurgeTags(ctx, rdb, "sample:1", "sample:list")
+	if err != nil {
+		t.Fatalf("expected non error, but some error occurred, %s", err.Error())
+	}
+	sort.Strings(paths)
+	if want := []string{"/sample", "/sample/1"}; !reflect.DeepEqual(want, paths) {
+		t.Errorf("test failed, got: %v, want: %v", paths, want)
+	}
+
+	for _, path := range []string{"/sample", "/sample/1"} {
+		if _, err := GetCache(ctx, rdb, path); err != redis.Nil {
+			t.Errorf("test failed, %s should be purged", path)
+		}
+	}
+	if val, _ := GetCache(ctx, rdb, "/sample/2"); val != "2" {
+		t.Errorf("test failed, got: %v, want: 2", val)
+	}
+}
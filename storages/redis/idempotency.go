@@ -0,0 +1,116 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// DefaultIdempotencyTTL is how long the response of an idempotent request is replayed
+const DefaultIdempotencyTTL = 24 * time.Hour
+
+// ErrIdempotencyClaimLost is returned when the claim of a key has expired and another request has claimed it
+var ErrIdempotencyClaimLost = errors.New("the claim of the idempotency key is lost")
+
+// IdempotencyRecord is what is stored for an idempotency key.
+// Response is empty while the first request is still running, and Token identifies the claim of that request.
+type IdempotencyRecord struct {
+	Fingerprint string          `json:"fingerprint"`
+	Token       string          `json:"token,omitempty"`
+	Done        bool            `json:"done"`
+	Response    json.RawMessage `json:"response,omitempty"`
+}
+
+func idempotencyKey(key string) string {
+	return fmt.Sprintf("idempotency:%s", key)
+}
+
+// AcquireIdempotencyKey claims key for a request whose body hashes to fingerprint, token is a random value
+// identifying the claim. It returns true when the caller has to run the request, otherwise the stored record is returned.
+// lockTTL bounds how long the key stays claimed when the caller never saves nor releases it.
+func AcquireIdempotencyKey(ctx context.Context, redisClient *redis.Client, key string, fingerprint string, token string, lockTTL time.Duration) (*IdempotencyRecord, bool, error) {
+	pending, err := json.Marshal(&IdempotencyRecord{Fingerprint: fingerprint, Token: token})
+	if err != nil {
+		return nil, false, err
+	}
+
+	// the record may expire between SETNX and GET, then it's claimed again
+	for i := 0; i < 3; i++ {
+		ok, err := redisClient.SetNX(ctx, idempotencyKey(key), pending, lockTTL).Result()
+		if err != nil {
+			return nil, false, err
+		}
+		if ok {
+			return nil, true, nil
+		}
+
+		val, err := redisClient.Get(ctx, idempotencyKey(key)).Bytes()
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		rec := &IdempotencyRecord{}
+		if err := json.Unmarshal(val, rec); err != nil {
+			return nil, false, err
+		}
+		return rec, false, nil
+	}
+
+	return nil, false, errors.New("cannot acquire idempotency key")
+}
+
+// saveScript sets KEYS[1] to ARGV[2] for ARGV[3] milliseconds only if it's still the claim ARGV[1]
+var saveScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	redis.call("SET", KEYS[1], ARGV[2], "PX", ARGV[3])
+	return 1
+end
+return 0
+`)
+
+// SaveIdempotencyKey stores the response of the request which acquired key with token, so that retries replay it.
+// It returns ErrIdempotencyClaimLost and keeps the key when the claim has expired and another request has claimed it.
+func SaveIdempotencyKey(ctx context.Context, redisClient *redis.Client, key string, fingerprint string, token string, response []byte, ttl time.Duration) error {
+	pending, err := json.Marshal(&IdempotencyRecord{Fingerprint: fingerprint, Token: token})
+	if err != nil {
+		return err
+	}
+	val, err := json.Marshal(&IdempotencyRecord{Fingerprint: fingerprint, Done: true, Response: response})
+	if err != nil {
+		return err
+	}
+
+	saved, err := saveScript.Run(ctx, redisClient, []string{idempotencyKey(key)}, pending, val, ttl.Milliseconds()).Int()
+	if err != nil {
+		return err
+	}
+	if saved == 0 {
+		return ErrIdempotencyClaimLost
+	}
+	return nil
+}
+
+// releaseScript deletes KEYS[1] only if it's still the claim ARGV[1]
+var releaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// ReleaseIdempotencyKey gives up the claim of key acquired with token, so that a retry runs the request again.
+// The key is kept when the claim has expired and another request has claimed it.
+func ReleaseIdempotencyKey(ctx context.Context, redisClient *redis.Client, key string, fingerprint string, token string) error {
+	pending, err := json.Marshal(&IdempotencyRecord{Fingerprint: fingerprint, Token: token})
+	if err != nil {
+		return err
+	}
+
+	return releaseScript.Run(ctx, redisClient, []string{idempotencyKey(key)}, pending).Err()
+}
@@ -10,6 +10,7 @@ func Initialize(url string) *redis.Client {
 		Password: "", // no password set
 		DB:       0,  // use default DB
 	})
+	rdb.AddHook(TracingHook{})
 
 	return rdb
 }
@@ -0,0 +1,55 @@
+package redis
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracingHook(t *testing.T) {
+	exp := tracetest.NewInMemoryExporter()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exp)))
+
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	rdb.AddHook(TracingHook{})
+
+	ctx, parent := otel.Tracer("test").Start(context.Background(), "request")
+	rdb.Set(ctx, "a", "1", 0)
+	rdb.Get(ctx, "missing")
+	rdb.Incr(ctx, "a")
+	rdb.HSet(ctx, "a", "f", "v")
+	pipe := rdb.Pipeline()
+	pipe.Get(ctx, "a")
+	pipe.Del(ctx, "a")
+	pipe.Exec(ctx)
+	parent.End()
+
+	type testCase struct {
+		Name  string
+		Error bool
+	}
+	want := []testCase{{"set", false}, {"get", false}, {"incr", false}, {"hset", true}, {"pipeline", false}}
+	spans := exp.GetSpans()
+	if len(spans) != len(want)+1 {
+		t.Fatalf("test failed, got: %v spans, want: %v", len(spans), len(want)+1)
+	}
+	for i, tc := range want {
+		s := spans[i]
+		if s.Name != tc.Name {
+			t.Errorf("test failed, got: %v, want: %v", s.Name, tc.Name)
+		}
+		if s.Parent.SpanID() != parent.SpanContext().SpanID() {
+			t.Errorf("%s: test failed, the span is not a child of the request", tc.Name)
+		}
+		if got := s.Status.Code == codes.Error; got != tc.Error {
+			t.Errorf("%s: test failed, got error: %v, want: %v", tc.Name, got, tc.Error)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package tracing
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+)
+
+func TestSetup(t *testing.T) {
+	type testCase struct {
+		Scenario string
+		Exporter string
+		Valid    bool
+	}
+	testCases := []testCase{
+		{"default", "", true},
+		{"none", ExporterNone, true},
+		{"stdout", ExporterStdout, true},
+		{"unknown", "zipkin", false},
+	}
+
+	for _, tc := range testCases {
+		shutdown, err := Setup(context.Background(), tc.Exporter, "test")
+		if got := err == nil; got != tc.Valid {
+			t.Errorf("%s: test failed, got: %v, want: %v", tc.Scenario, err, tc.Valid)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if err := shutdown(context.Background()); err != nil {
+			t.Errorf("%s: expected non error, but some error occurred, %s", tc.Scenario, err.Error())
+		}
+	}
+
+	// the composite propagator doesn't keep the order of the fields
+	fields := otel.GetTextMapPropagator().Fields()
+	found := false
+	for _, f := range fields {
+		if f == "traceparent" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("test failed, got: %v, want: traceparent", fields)
+	}
+}